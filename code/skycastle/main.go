@@ -1,10 +1,17 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"os/signal"
 	"skycastle/skycastle"
+	"syscall"
+	"time"
 
 	"github.com/charmbracelet/log"
 	"github.com/spf13/cobra"
@@ -12,12 +19,90 @@ import (
 
 var ErrWorkflowNotFound = fmt.Errorf("workflow not found")
 
+// errReported is returned by commands that have already reported why they
+// failed, so that the CLI exits with a failure without logging again.
+var errReported = errors.New("failure already reported")
+
 var logLevel string
 
+var progress bool
+
+var strict bool
+
+var manifestPath string
+
+var workflowName string
+
+var fmtCheck bool
+
+// parseTargetArg parses a target argument. "-" reads the workflow source from
+// stdin and selects the workflow named by --workflow-name, returning the
+// option that supplies the source.
+func parseTargetArg(arg string) (skycastle.Target, []skycastle.ExecutionOption, error) {
+	if arg != "-" {
+		target, err := skycastle.ParseTarget(arg)
+		return target, nil, err
+	}
+
+	if workflowName == "" {
+		return skycastle.Target{}, nil, fmt.Errorf("--workflow-name is required when reading a workflow from stdin")
+	}
+
+	src, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return skycastle.Target{}, nil, fmt.Errorf("failed to read workflow from stdin: %w", err)
+	}
+
+	target := skycastle.Target{Path: skycastle.StdinPackagePath, Name: workflowName}
+	return target, []skycastle.ExecutionOption{skycastle.WithSource(skycastle.StdinPackagePath, src)}, nil
+}
+
+// evaluate evaluates the workflow named by a target argument with the
+// execution options given on the command line, so that every command that
+// evaluates a workflow honours them alike.
+func evaluate(cmd *cobra.Command, arg string) (skycastle.Workflow, error) {
+	target, sourceOpts, err := parseTargetArg(arg)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []skycastle.ExecutionOption{
+		skycastle.WithConcurrencyLimit(1),
+		skycastle.WithStrict(strict),
+	}
+	opts = append(opts, sourceOpts...)
+
+	var reporter *skycastle.ProgressReporter
+	if progress {
+		reporter = skycastle.NewProgressReporter(os.Stderr, time.Second)
+		opts = append(opts, skycastle.WithProgress(reporter.Report))
+	}
+
+	executionOptions, err := skycastle.NewExecutionOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	workflow, err := skycastle.Execute(cmd.Context(), executionOptions, target)
+	if reporter != nil {
+		reporter.Done()
+	}
+	return workflow, err
+}
+
 func main() {
+	os.Exit(run())
+}
+
+// run runs the CLI and returns its exit code. Commands return their errors
+// instead of exiting, so that deferred cleanup such as releasing the signal
+// handler happens before the process exits.
+func run() int {
 	rootCmd := &cobra.Command{
-		Use:   "skycastle",
-		Short: "Skycastle CLI",
+		Use:           "skycastle",
+		Short:         "Skycastle CLI",
+		SilenceErrors: true,
+		SilenceUsage:  true,
 		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 			level, err := log.ParseLevel(logLevel)
 			if err != nil {
@@ -35,39 +120,344 @@ func main() {
 		"Set the logging level (debug, info, warn, error)",
 	)
 
+	rootCmd.PersistentFlags().StringVar(
+		&workflowName,
+		"workflow-name",
+		"",
+		"Name of the workflow to use when the target is - (read from stdin)",
+	)
+
+	rootCmd.PersistentFlags().BoolVar(
+		&strict,
+		"strict",
+		false,
+		"Report undefined names with their position and a suggested builtin",
+	)
+
+	rootCmd.PersistentFlags().BoolVar(
+		&progress,
+		"progress",
+		false,
+		"Report workflow evaluation progress to stderr",
+	)
+
 	describeCmd := &cobra.Command{
-		Use:   "describe <target>",
+		Use:   "describe <target|->",
 		Short: "Describe a workflow",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			target, err := skycastle.ParseTarget(args[0])
+			workflow, err := evaluate(cmd, args[0])
+			if err != nil {
+				return err
+			}
+
+			workflow.PrettyPrint(os.Stdout)
+			return nil
+		},
+	}
+
+	expectCmd := &cobra.Command{
+		Use:   "expect <target|->",
+		Short: "Check that a workflow's goals match an expected manifest",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			manifestFile, err := os.Open(manifestPath)
 			if err != nil {
-				slog.Error(err.Error())
-				os.Exit(1)
+				return err
 			}
+			defer manifestFile.Close()
 
-			executionOptions, err := skycastle.NewExecutionOptions(
-				skycastle.WithConcurrencyLimit(1),
-			)
+			expected, err := skycastle.ReadManifest(manifestFile)
 			if err != nil {
-				slog.Error(err.Error())
-				os.Exit(1)
+				return err
 			}
 
-			workflow, err := skycastle.Execute(cmd.Context(), executionOptions, target)
+			workflow, err := evaluate(cmd, args[0])
 			if err != nil {
-				slog.Error(err.Error())
-				os.Exit(1)
+				return err
 			}
 
-			workflow.PrettyPrint(os.Stdout)
+			missing, unexpected := skycastle.DiffManifest(expected, skycastle.GoalManifest(workflow))
+			if len(missing) == 0 && len(unexpected) == 0 {
+				return nil
+			}
+
+			for _, goal := range missing {
+				fmt.Fprintf(os.Stdout, "- %s\n", goal)
+			}
+			for _, goal := range unexpected {
+				fmt.Fprintf(os.Stdout, "+ %s\n", goal)
+			}
+			return errReported
+		},
+	}
+
+	expectCmd.Flags().StringVar(
+		&manifestPath,
+		"manifest",
+		"",
+		"Path to the expected goal manifest",
+	)
+	expectCmd.MarkFlagRequired("manifest")
+
+	validateCmd := &cobra.Command{
+		Use:   "validate <target|->",
+		Short: "Check that a workflow's graph has no dependency cycles",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Building the workflow validates its graph, so a cycle surfaces
+			// as an evaluation error naming its actions and artifacts.
+			workflow, err := evaluate(cmd, args[0])
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(os.Stdout, "%s: ok\n", workflow.Target())
+			return nil
+		},
+	}
+
+	widthCmd := &cobra.Command{
+		Use:   "width <target|->",
+		Short: "Report the most actions of a workflow that can run in parallel",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			workflow, err := evaluate(cmd, args[0])
+			if err != nil {
+				return err
+			}
+
+			levels := skycastle.ExecutionLevels(workflow)
+			level, width := skycastle.MaxParallelWidth(levels)
+
+			fmt.Fprintf(os.Stdout, "max parallel width: %d (level %d of %d)\n", width, level, len(levels))
+			if width > 0 {
+				for _, action := range levels[level] {
+					name := action.Description()
+					if name == "" {
+						name = action.Command()
+					}
+					fmt.Fprintf(os.Stdout, "  %s\n", name)
+				}
+			}
+			return nil
+		},
+	}
+
+	statsCmd := &cobra.Command{
+		Use:   "stats <target|->",
+		Short: "Count the actions, artifacts and links of a workflow",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			workflow, err := evaluate(cmd, args[0])
+			if err != nil {
+				return err
+			}
+
+			stats := workflow.Stats()
+			fmt.Fprintf(os.Stdout, "actions:   %d\n", stats.Actions)
+			fmt.Fprintf(os.Stdout, "artifacts: %d\n", stats.Artifacts)
+			fmt.Fprintf(os.Stdout, "links:     %d (%d inputs, %d outputs, %d deps)\n",
+				stats.Links(), stats.Inputs, stats.Outputs, stats.Deps)
+			return nil
+		},
+	}
+
+	// Workflows are evaluated from Starlark source on every run, so there is
+	// no stored graph to rewrite; dedupe only reports what would be merged.
+	dedupeCmd := &cobra.Command{
+		Use:   "dedupe <target|->",
+		Short: "List groups of duplicate actions in a workflow",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			workflow, err := evaluate(cmd, args[0])
+			if err != nil {
+				return err
+			}
+
+			groups := workflow.DuplicateActions()
+			if len(groups) == 0 {
+				fmt.Fprintf(os.Stdout, "%s: no duplicate actions\n", workflow.Target())
+				return nil
+			}
+
+			for _, group := range groups {
+				name := group[0].Description()
+				if name == "" {
+					name = group[0].Command()
+				}
+				fmt.Fprintf(os.Stdout, "%s: %d copies, %d would be removed\n", name, len(group), len(group)-1)
+			}
+			return nil
+		},
+	}
+
+	fmtCmd := &cobra.Command{
+		Use:   "fmt <file|->...",
+		Short: "Rewrite workflow files in canonical form",
+		Long: "Rewrite workflow files in canonical form, in place. \"-\" formats stdin to stdout.\n" +
+			"With --check, nothing is written: unformatted files are listed and the command fails.",
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			unformatted := false
+			for _, path := range args {
+				var src []byte
+				var err error
+				if path == "-" {
+					src, err = io.ReadAll(os.Stdin)
+				} else {
+					src, err = os.ReadFile(path)
+				}
+				if err != nil {
+					return err
+				}
+
+				formatted, err := skycastle.Format(path, src)
+				if err != nil {
+					return fmt.Errorf("%s: %w", path, err)
+				}
+
+				switch {
+				case fmtCheck:
+					if !bytes.Equal(formatted, src) {
+						fmt.Fprintln(os.Stdout, path)
+						unformatted = true
+					}
+				case path == "-":
+					os.Stdout.Write(formatted)
+				case !bytes.Equal(formatted, src):
+					if err := os.WriteFile(path, formatted, 0o644); err != nil {
+						return err
+					}
+				}
+			}
+
+			if unformatted {
+				return errReported
+			}
+			return nil
+		},
+	}
+	fmtCmd.Flags().BoolVar(
+		&fmtCheck,
+		"check",
+		false,
+		"List unformatted files and fail instead of rewriting them",
+	)
+
+	graphCmd := &cobra.Command{
+		Use:   "graph",
+		Short: "Export a workflow's graph",
+	}
+
+	graphDotCmd := &cobra.Command{
+		Use:   "dot <target|->",
+		Short: "Write a workflow's graph in Graphviz DOT format",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			workflow, err := evaluate(cmd, args[0])
+			if err != nil {
+				return err
+			}
+
+			if err := workflow.ExportDOT(os.Stdout); err != nil {
+				return err
+			}
+			return nil
+		},
+	}
+	graphCmd.AddCommand(graphDotCmd)
+
+	graphJSONLCmd := &cobra.Command{
+		Use:   "jsonl <target|->",
+		Short: "Write a workflow's graph as JSON Lines, as read by fsck",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			workflow, err := evaluate(cmd, args[0])
+			if err != nil {
+				return err
+			}
+
+			if err := workflow.ExportJSONL(os.Stdout); err != nil {
+				return err
+			}
+			return nil
+		},
+	}
+	graphCmd.AddCommand(graphJSONLCmd)
+
+	graphJSONCmd := &cobra.Command{
+		Use:   "json <target|->",
+		Short: "Write a workflow's graph as a single versioned JSON document",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			workflow, err := evaluate(cmd, args[0])
+			if err != nil {
+				return err
+			}
+
+			if err := workflow.ExportJSON(os.Stdout); err != nil {
+				return err
+			}
+			return nil
+		},
+	}
+	graphCmd.AddCommand(graphJSONCmd)
+
+	// fsck checks a graph exported by "graph jsonl", which may since have
+	// been edited or produced by other tools: importing it checks that every
+	// line decodes and every edge names an existing action and artifact, and
+	// Check covers the rest.
+	fsckCmd := &cobra.Command{
+		Use:   "fsck <graph.jsonl|->",
+		Short: "Check the integrity of an exported workflow graph",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var r io.Reader = os.Stdin
+			if args[0] != "-" {
+				f, err := os.Open(args[0])
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				r = f
+			}
+
+			graph, err := skycastle.ImportJSONL(r)
+			if err != nil {
+				return err
+			}
+
+			if err := graph.Check(); err != nil {
+				fmt.Fprintln(os.Stdout, err)
+				return errReported
+			}
+
+			fmt.Fprintf(os.Stdout, "%s: ok (%d actions, %d artifacts)\n", args[0], len(graph.Edges), len(graph.Nodes))
 			return nil
 		},
 	}
 
 	rootCmd.AddCommand(describeCmd)
+	rootCmd.AddCommand(expectCmd)
+	rootCmd.AddCommand(validateCmd)
+	rootCmd.AddCommand(widthCmd)
+	rootCmd.AddCommand(statsCmd)
+	rootCmd.AddCommand(dedupeCmd)
+	rootCmd.AddCommand(fmtCmd)
+	rootCmd.AddCommand(fsckCmd)
+	rootCmd.AddCommand(graphCmd)
+
+	// Cancel the root context on SIGINT/SIGTERM so in-flight work can stop
+	// cleanly instead of being killed.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	if err := rootCmd.Execute(); err != nil {
-		os.Exit(1)
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
+		if !errors.Is(err, errReported) {
+			slog.Error(err.Error())
+		}
+		return 1
 	}
+	return 0
 }
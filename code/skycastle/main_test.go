@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// runMain runs the CLI with args in a child process, so that commands which
+// call os.Exit can be tested, and returns its exit code and output.
+func runMain(t *testing.T, args ...string) (int, string) {
+	t.Helper()
+	return runMainWithStdin(t, "", args...)
+}
+
+// runMainWithStdin is runMain with stdin supplying the given text.
+func runMainWithStdin(t *testing.T, stdin string, args ...string) (int, string) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], append([]string{"-test.run=^TestMainProcess$", "--"}, args...)...)
+	cmd.Env = append(os.Environ(), "SKYCASTLE_TEST_MAIN=1")
+	cmd.Stdin = strings.NewReader(stdin)
+
+	out, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), string(out)
+	}
+	if err != nil {
+		t.Fatalf("running the CLI: %v", err)
+	}
+	return 0, string(out)
+}
+
+// TestMainProcess is not a test: it runs main with the arguments after "--"
+// when started by runMain.
+func TestMainProcess(t *testing.T) {
+	if os.Getenv("SKYCASTLE_TEST_MAIN") != "1" {
+		return
+	}
+	for i, arg := range os.Args {
+		if arg == "--" {
+			os.Args = append([]string{"skycastle"}, os.Args[i+1:]...)
+			break
+		}
+	}
+	main()
+	os.Exit(0)
+}
+
+func TestFmtCheck(t *testing.T) {
+	dir := t.TempDir()
+	formatted := filepath.Join(dir, "formatted.star")
+	unformatted := filepath.Join(dir, "unformatted.star")
+	empty := filepath.Join(dir, "empty.star")
+	for path, src := range map[string]string{
+		formatted:   "x = 1  # one\n",
+		unformatted: "x=1 # one\n",
+		empty:       "",
+	} {
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if code, out := runMain(t, "fmt", "--check", formatted, empty); code != 0 {
+		t.Fatalf("expected formatted files to pass, got exit code %d:\n%s", code, out)
+	}
+
+	code, out := runMain(t, "fmt", "--check", formatted, unformatted)
+	if code == 0 {
+		t.Fatalf("expected an unformatted file to fail the check:\n%s", out)
+	}
+	if out != unformatted+"\n" {
+		t.Fatalf("expected only the unformatted file to be listed, got %q", out)
+	}
+
+	src, err := os.ReadFile(unformatted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(src) != "x=1 # one\n" {
+		t.Fatalf("expected --check not to rewrite the file, got %q", src)
+	}
+}
+
+func TestEvaluatingCommands_ShareOptions(t *testing.T) {
+	t.Setenv("SKYCASTLE_REPO_ROOT", t.TempDir())
+	manifest := filepath.Join(t.TempDir(), "manifest")
+	if err := os.WriteFile(manifest, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	src := "greet = action(command = \"echo hi\")\nworkflow(name = \"greet\", goals = [greet.stdout])\n"
+	typo := "actoin(command = \"true\")\n"
+
+	for _, command := range [][]string{
+		{"describe"},
+		{"expect", "--manifest", manifest},
+		{"validate"},
+		{"width"},
+		{"stats"},
+		{"dedupe"},
+		{"graph", "dot"},
+	} {
+		t.Run(strings.Join(command, "_"), func(t *testing.T) {
+			args := append(slices.Clone(command), "--workflow-name", "greet", "--progress", "-")
+			if _, out := runMainWithStdin(t, src, args...); !strings.Contains(out, "1 actions, ") {
+				t.Fatalf("expected --progress to report evaluation, got:\n%s", out)
+			}
+
+			args = append(slices.Clone(command), "--workflow-name", "greet", "--strict", "-")
+			code, out := runMainWithStdin(t, typo, args...)
+			if code == 0 || !strings.Contains(out, "did you mean action?") {
+				t.Fatalf("expected --strict to reject the typo with a suggestion, got exit code %d:\n%s", code, out)
+			}
+		})
+	}
+}
+
+func TestGraphJSONL_ExportPassesFsck(t *testing.T) {
+	t.Setenv("SKYCASTLE_REPO_ROOT", t.TempDir())
+
+	src := "build = action(command = \"make\")\n" +
+		"test = action(command = \"make test\", inputs = {\"BIN\": build.stdout})\n" +
+		"workflow(name = \"ci\", goals = [test.stdout])\n"
+	code, out := runMainWithStdin(t, src, "graph", "jsonl", "--log-level", "warn", "--workflow-name", "ci", "-")
+	if code != 0 {
+		t.Fatalf("graph jsonl failed with exit code %d:\n%s", code, out)
+	}
+
+	export := filepath.Join(t.TempDir(), "graph.jsonl")
+	if err := os.WriteFile(export, []byte(out), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	code, out = runMain(t, "fsck", export)
+	if code != 0 || out != export+": ok (2 actions, 4 artifacts)\n" {
+		t.Fatalf("expected the export to pass fsck, got exit code %d:\n%s", code, out)
+	}
+}
+
+func TestFsck_RejectsRepeatedAction(t *testing.T) {
+	t.Setenv("SKYCASTLE_REPO_ROOT", t.TempDir())
+
+	src := "build = action(command = \"make\")\nworkflow(name = \"ci\", goals = [build.stdout])\n"
+	code, out := runMainWithStdin(t, src, "graph", "jsonl", "--log-level", "warn", "--workflow-name", "ci", "-")
+	if code != 0 {
+		t.Fatalf("graph jsonl failed with exit code %d:\n%s", code, out)
+	}
+
+	// Repeating the action line after its edges would drop them.
+	var action string
+	for _, line := range strings.SplitAfter(out, "\n") {
+		if strings.Contains(line, `"type":"action"`) {
+			action = line
+		}
+	}
+	if action == "" {
+		t.Fatalf("expected an action line in the export:\n%s", out)
+	}
+
+	export := filepath.Join(t.TempDir(), "graph.jsonl")
+	if err := os.WriteFile(export, []byte(out+action), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	code, out = runMain(t, "fsck", export)
+	if code == 0 || !strings.Contains(out, "appears more than once") {
+		t.Fatalf("expected fsck to reject the repeated action, got exit code %d:\n%s", code, out)
+	}
+}
+
+func TestCommandErrors_ReportedOnce(t *testing.T) {
+	code, out := runMain(t, "describe", "-")
+	if code != 1 {
+		t.Fatalf("expected exit code 1, got %d:\n%s", code, out)
+	}
+	if n := strings.Count(out, "--workflow-name is required"); n != 1 {
+		t.Fatalf("expected the error to be reported once, got %d times:\n%s", n, out)
+	}
+	if strings.Contains(out, "Usage:") {
+		t.Fatalf("expected no usage text for a failed command:\n%s", out)
+	}
+}
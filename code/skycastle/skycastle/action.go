@@ -7,10 +7,18 @@ type Action interface {
 	Description() string
 	Command() string
 	Policy() Policy
+	NoCache() bool
 	Input(port Port) (Artifact, bool)
 	Output(port Port) (Artifact, bool)
 	Inputs() iter.Seq2[Port, Artifact]
 	Outputs() iter.Seq2[Port, Artifact]
+	OrderedInputs() []PortArtifact
+	OrderedOutputs() []PortArtifact
+	Deps() []Artifact
+	Siblings() iter.Seq[Action]
 	Env() iter.Seq2[string, string]
 	EnvVar(name string) (string, bool)
+	WorkingDir() string
+	Annotations() iter.Seq2[string, string]
+	Annotation(key string) (string, bool)
 }
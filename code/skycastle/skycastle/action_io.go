@@ -0,0 +1,96 @@
+package skycastle
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// ActionIO describes everything AddActionWithIO wires to a new action.
+type ActionIO struct {
+	// Inputs are bound to named input ports. A non-nil InputOrder declares
+	// their positional order, as SetInputOrder does.
+	Inputs     map[Port]ArtifactHandle
+	InputOrder []Port
+
+	// Deps are hidden dependencies, as added by AddDep.
+	Deps []ArtifactHandle
+
+	// Outputs are existing artifacts the action produces.
+	Outputs map[Port]ArtifactHandle
+
+	// OutputFiles are new file artifacts created along with the action, one
+	// per port, each with the given options.
+	OutputFiles map[Port][]ArtifactOption
+}
+
+// AddActionWithIO adds an action together with its inputs, deps and outputs
+// as a single step. If anything cannot be wired, the action and any output
+// files created for it are removed again, so the graph is left exactly as it
+// was and the error is returned. Progress is only reported for an action that
+// was added.
+//
+// It returns the handle of the action and of each created output file.
+func (b *WorkflowGraphBuilder) AddActionWithIO(command string, spec ActionIO, opts ...ActionOption) (ActionHandle, map[Port]ArtifactHandle, error) {
+	progress := b.Progress
+	b.Progress = nil
+	defer func() { b.Progress = progress }()
+
+	action := b.AddAction(command, opts...)
+	files := make(map[Port]ArtifactHandle, len(spec.OutputFiles))
+
+	if err := b.wireActionIO(action, spec, files); err != nil {
+		for _, artifact := range files {
+			b.removeArtifact(b.ArtifactHandles[artifact])
+		}
+		delete(b.Cospan.Apex.Edges, b.ActionHandles[action])
+		delete(b.ActionHandles, action)
+		b.index = nil
+		return ActionHandle{}, nil, err
+	}
+
+	b.Progress = progress
+	b.reportProgress(ProgressActionAdded)
+	for range files {
+		b.reportProgress(ProgressArtifactAdded)
+	}
+	return action, files, nil
+}
+
+// wireActionIO wires spec to a freshly added action, recording each output
+// file it creates in files so a failure can be undone.
+func (b *WorkflowGraphBuilder) wireActionIO(action ActionHandle, spec ActionIO, files map[Port]ArtifactHandle) error {
+	for _, port := range slices.Sorted(maps.Keys(spec.OutputFiles)) {
+		if _, ok := spec.Outputs[port]; ok {
+			return fmt.Errorf("output %s is given more than once", port)
+		}
+		artifact := b.AddFileArtifact(spec.OutputFiles[port]...)
+		files[port] = artifact
+		if err := b.WireOutput(action, port, artifact); err != nil {
+			return fmt.Errorf("failed to add output %s: %w", port, err)
+		}
+	}
+
+	if err := b.AddInputs(action, spec.Inputs); err != nil {
+		return fmt.Errorf("failed to add inputs: %w", err)
+	}
+	if spec.InputOrder != nil {
+		if err := b.SetInputOrder(action, spec.InputOrder); err != nil {
+			return fmt.Errorf("failed to order inputs: %w", err)
+		}
+	}
+
+	for _, dep := range spec.Deps {
+		if err := b.AddDep(action, dep); err != nil {
+			return fmt.Errorf("failed to add dep %s: %w", Unique(dep).String(), err)
+		}
+	}
+
+	for _, port := range slices.Sorted(maps.Keys(spec.Outputs)) {
+		if err := b.AddOutput(action, port, spec.Outputs[port]); err != nil {
+			return fmt.Errorf("failed to add output %s: %w", port, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package skycastle
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAddActionWithIO_WiresEverything(t *testing.T) {
+	b := NewWorkflowGraphBuilder()
+	var events []ProgressEvent
+	b.Progress = func(event ProgressEvent) { events = append(events, event) }
+
+	src := b.AddFileArtifact(WithArtifactPath("main.go"))
+	lib := b.AddFileArtifact(WithArtifactPath("lib.go"))
+	bin := b.AddFileArtifact(WithArtifactDescription("bin"))
+	events = nil
+
+	action, files, err := b.AddActionWithIO("go build", ActionIO{
+		Inputs:      map[Port]ArtifactHandle{"SRC": src},
+		InputOrder:  []Port{"SRC"},
+		Deps:        []ArtifactHandle{lib},
+		Outputs:     map[Port]ArtifactHandle{"BIN": bin},
+		OutputFiles: map[Port][]ArtifactOption{"LOG": {WithArtifactDescription("log")}},
+	})
+	if err != nil {
+		t.Fatalf("AddActionWithIO: %v", err)
+	}
+
+	edge := b.Cospan.Apex.Edges[b.ActionHandles[action]]
+	if edge.Inputs["SRC"] != b.ArtifactHandles[src] || len(edge.InputOrder) != 1 {
+		t.Fatalf("expected SRC to be an ordered input, got %+v", edge)
+	}
+	if len(edge.Deps) != 1 || edge.Deps[0] != b.ArtifactHandles[lib] {
+		t.Fatalf("expected lib as a dep, got %v", edge.Deps)
+	}
+	if edge.Outputs["BIN"] != b.ArtifactHandles[bin] || edge.Outputs["LOG"] != b.ArtifactHandles[files["LOG"]] {
+		t.Fatalf("expected BIN and LOG outputs, got %v", edge.Outputs)
+	}
+	if b.Cospan.Apex.Nodes[b.ArtifactHandles[files["LOG"]]].Description != "log" {
+		t.Fatalf("expected the created output file to carry its options")
+	}
+	if len(events) != 2 || events[0] != ProgressActionAdded || events[1] != ProgressArtifactAdded {
+		t.Fatalf("expected one action and one artifact to be reported, got %v", events)
+	}
+}
+
+func TestAddActionWithIO_FailureLeavesGraphUnchanged(t *testing.T) {
+	b := NewWorkflowGraphBuilder()
+	var events []ProgressEvent
+	b.Progress = func(event ProgressEvent) { events = append(events, event) }
+
+	src := b.AddFileArtifact(WithArtifactPath("main.go"))
+	events = nil
+
+	// The last thing wired is an output that is also an input, so the
+	// action, its inputs and its created output file are all undone.
+	_, _, err := b.AddActionWithIO("go build", ActionIO{
+		Inputs:      map[Port]ArtifactHandle{"SRC": src},
+		Outputs:     map[Port]ArtifactHandle{"OUT": src},
+		OutputFiles: map[Port][]ArtifactOption{"LOG": nil},
+	})
+	if !errors.Is(err, ErrSelfDependency) {
+		t.Fatalf("expected ErrSelfDependency, got %v", err)
+	}
+
+	if len(b.Cospan.Apex.Edges) != 0 || len(b.ActionHandles) != 0 {
+		t.Fatalf("expected no actions, got %d", len(b.Cospan.Apex.Edges))
+	}
+	if len(b.Cospan.Apex.Nodes) != 1 || len(b.ArtifactHandles) != 1 {
+		t.Fatalf("expected only the source to remain, got %d artifacts", len(b.Cospan.Apex.Nodes))
+	}
+	if len(events) != 0 {
+		t.Fatalf("expected nothing to be reported, got %v", events)
+	}
+
+	if _, _, err := b.AddActionWithIO("true", ActionIO{
+		Deps: []ArtifactHandle{NewArtifactHandle()},
+	}); !errors.Is(err, ErrInvalidArtifactHandle) {
+		t.Fatalf("expected ErrInvalidArtifactHandle, got %v", err)
+	}
+	if len(b.Cospan.Apex.Edges) != 0 {
+		t.Fatalf("expected no actions after an unknown dep, got %d", len(b.Cospan.Apex.Edges))
+	}
+}
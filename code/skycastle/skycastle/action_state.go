@@ -0,0 +1,62 @@
+package skycastle
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrIllegalTransition     = errors.New("illegal status transition")
+	ErrUnknownActionInstance = errors.New("unknown action instance")
+)
+
+// CanTransitionTo reports whether an action may move from status kind k to
+// to. A pending action starts or is cancelled, a running one succeeds, fails
+// or is cancelled, and a terminal status is final. Retrying a failed action
+// creates a new ActionInstance rather than reviving the old one.
+func (k StatusKind) CanTransitionTo(to StatusKind) bool {
+	switch k {
+	case StatusKind_Pending:
+		return to == StatusKind_InProgress || to == StatusKind_Cancelled
+	case StatusKind_InProgress:
+		return to == StatusKind_Succeeded || to == StatusKind_Failed || to == StatusKind_Cancelled
+	default:
+		return false
+	}
+}
+
+// Transition moves the action to status. It fails with ErrIllegalTransition,
+// leaving the status unchanged, if CanTransitionTo forbids the move or if the
+// action is started before all of its inputs are ready. An action without a
+// status is pending.
+func (a *ActionInstance) Transition(status isActionInstance_Status) error {
+	from := StatusKind_Pending
+	if a.Status != nil {
+		from = a.Status.Kind()
+	}
+	to := status.Kind()
+
+	if !from.CanTransitionTo(to) {
+		return fmt.Errorf("%w: %s to %s", ErrIllegalTransition, from, to)
+	}
+	if to == StatusKind_InProgress && !a.IsReady() {
+		return fmt.Errorf("%w: %s to %s: inputs are not ready", ErrIllegalTransition, from, to)
+	}
+
+	a.Status = status
+	return nil
+}
+
+// TransitionAction moves an action of the workflow to status, as
+// ActionInstance.Transition does.
+func (w *WorkflowInstance) TransitionAction(id ActionInstanceId, status isActionInstance_Status) error {
+	action, ok := w.Actions[id]
+	if !ok {
+		return ErrUnknownActionInstance
+	}
+	if err := action.Transition(status); err != nil {
+		return err
+	}
+	w.Actions[id] = action
+	return nil
+}
@@ -0,0 +1,68 @@
+package skycastle
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ipfs/go-cid"
+)
+
+func TestActionInstance_Transition(t *testing.T) {
+	input := &ArtifactInstance{Status: &ArtifactInstance_Status_Pending{}}
+	id := ActionInstanceId(uuid.New())
+	w := &WorkflowInstance{
+		Actions: map[ActionInstanceId]ActionInstance{
+			id: {
+				Id:     id,
+				Status: &Status_Pending{From: time.Now()},
+				Inputs: map[Port]*ArtifactInstance{"IN": input},
+			},
+		},
+	}
+
+	if err := w.TransitionAction(id, &Status_InProgress{}); !errors.Is(err, ErrIllegalTransition) {
+		t.Fatalf("expected starting with unready inputs to fail, got %v", err)
+	}
+	if err := w.TransitionAction(id, &Status_Succeeded{}); !errors.Is(err, ErrIllegalTransition) {
+		t.Fatalf("expected a pending action not to succeed, got %v", err)
+	}
+	if kind := w.Actions[id].Status.Kind(); kind != StatusKind_Pending {
+		t.Fatalf("expected a failed transition to leave the action pending, got %s", kind)
+	}
+
+	input.SetReady(Digest{}, cid.Undef, 0)
+	for _, status := range []isActionInstance_Status{
+		&Status_InProgress{From: time.Now()},
+		&ActionInstance_Status_Failed{At: time.Now(), ExitCode: 1},
+	} {
+		if err := w.TransitionAction(id, status); err != nil {
+			t.Fatalf("transition to %s: %v", status.Kind(), err)
+		}
+	}
+
+	if err := w.TransitionAction(id, &Status_InProgress{}); !errors.Is(err, ErrIllegalTransition) {
+		t.Fatalf("expected a failed action to stay failed, got %v", err)
+	}
+	if err := w.TransitionAction(ActionInstanceId(uuid.New()), &Status_InProgress{}); !errors.Is(err, ErrUnknownActionInstance) {
+		t.Fatalf("expected ErrUnknownActionInstance, got %v", err)
+	}
+}
+
+func TestStatusKind_CanTransitionTo(t *testing.T) {
+	kinds := []StatusKind{StatusKind_Pending, StatusKind_InProgress, StatusKind_Succeeded, StatusKind_Failed, StatusKind_Cancelled}
+	for _, from := range kinds {
+		for _, to := range kinds {
+			if from.IsTerminal() && from.CanTransitionTo(to) {
+				t.Errorf("expected terminal %s not to move to %s", from, to)
+			}
+			if from == to && from.CanTransitionTo(to) {
+				t.Errorf("expected %s not to move to itself", from)
+			}
+		}
+	}
+	if !StatusKind_Pending.CanTransitionTo(StatusKind_Cancelled) || !StatusKind_InProgress.CanTransitionTo(StatusKind_Cancelled) {
+		t.Errorf("expected pending and running actions to be cancellable")
+	}
+}
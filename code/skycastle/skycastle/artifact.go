@@ -1,29 +1,136 @@
 package skycastle
 
-import "iter"
+import (
+	"errors"
+	"fmt"
+	"iter"
+	"slices"
+	"strings"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
+)
 
 type ArtifactKind uint8
 
 const (
 	ArtifactKindFile ArtifactKind = iota
 	ArtifactKindDirectory
+	ArtifactKindSymlink
+	ArtifactKindArchive
+	ArtifactKindImage
+)
+
+var (
+	ErrInvalidArtifactKind     = errors.New("invalid artifact kind")
+	ErrInvalidArtifactMetadata = errors.New("invalid artifact metadata")
 )
 
+// Valid reports whether k is one of the known artifact kinds.
+func (k ArtifactKind) Valid() bool {
+	switch k {
+	case ArtifactKindFile, ArtifactKindDirectory, ArtifactKindSymlink, ArtifactKindArchive, ArtifactKindImage:
+		return true
+	default:
+		return false
+	}
+}
+
 func (k ArtifactKind) String() string {
 	switch k {
 	case ArtifactKindFile:
 		return "file"
 	case ArtifactKindDirectory:
 		return "directory"
+	case ArtifactKindSymlink:
+		return "symlink"
+	case ArtifactKindArchive:
+		return "archive"
+	case ArtifactKindImage:
+		return "image"
 	default:
 		panic("unknown ArtifactKind")
 	}
 }
 
+// ArchiveFormats are the container formats an archive artifact can have, and
+// ArchiveCompressions the compressions a tar archive can have. Zip archives
+// compress their entries themselves, so they take no compression.
+var (
+	ArchiveFormats      = []string{"tar", "zip"}
+	ArchiveCompressions = []string{"gzip", "xz", "zstd"}
+)
+
+// Validate checks that an artifact has the metadata its kind requires and
+// none that belongs to other kinds: a symlink needs a link target, an
+// archive a known format and compression, and an image a reference.
+func (n WorkflowGraphNode) Validate() error {
+	if !n.Kind.Valid() {
+		return fmt.Errorf("%w: %d", ErrInvalidArtifactKind, n.Kind)
+	}
+
+	invalid := func(format string, args ...any) error {
+		return fmt.Errorf("%w: %s: "+format, append([]any{ErrInvalidArtifactMetadata, n.Kind}, args...)...)
+	}
+
+	if n.Kind != ArtifactKindSymlink && n.LinkTarget != "" {
+		return invalid("only symlinks have a link target")
+	}
+	if n.Kind != ArtifactKindArchive && (n.ArchiveFormat != "" || n.Compression != "") {
+		return invalid("only archives have an archive format or compression")
+	}
+	if n.Kind != ArtifactKindImage && n.ImageRef != "" {
+		return invalid("only images have an image reference")
+	}
+
+	switch n.Kind {
+	case ArtifactKindSymlink:
+		if n.LinkTarget == "" {
+			return invalid("a link target is required")
+		}
+	case ArtifactKindArchive:
+		if !slices.Contains(ArchiveFormats, n.ArchiveFormat) {
+			return invalid("archive format must be one of %s, got %q", strings.Join(ArchiveFormats, ", "), n.ArchiveFormat)
+		}
+		if n.Compression != "" && !slices.Contains(ArchiveCompressions, n.Compression) {
+			return invalid("compression must be one of %s, got %q", strings.Join(ArchiveCompressions, ", "), n.Compression)
+		}
+		if n.ArchiveFormat == "zip" && n.Compression != "" {
+			return invalid("zip archives take no compression")
+		}
+	case ArtifactKindImage:
+		if n.ImageRef == "" || strings.ContainsFunc(n.ImageRef, func(r rune) bool { return r <= ' ' }) {
+			return invalid("image reference must be non-empty and contain no whitespace, got %q", n.ImageRef)
+		}
+	}
+	return nil
+}
+
+// kindMetadata returns the kind-specific metadata of an artifact that
+// affects what it is, for digests and duplicate detection. It is empty for
+// files and directories.
+func (n WorkflowGraphNode) kindMetadata() tuple.Tuple {
+	switch n.Kind {
+	case ArtifactKindSymlink:
+		return tuple.Tuple{n.LinkTarget}
+	case ArtifactKindArchive:
+		return tuple.Tuple{n.ArchiveFormat, n.Compression}
+	case ArtifactKindImage:
+		return tuple.Tuple{n.ImageRef}
+	default:
+		return tuple.Tuple{}
+	}
+}
+
 type Artifact interface {
 	Workflow() Workflow
 	Description() string
 	Kind() ArtifactKind
+	Path() string
+	Format() string
+	LinkTarget() string
+	ArchiveFormat() string
+	Compression() string
+	ImageRef() string
 	Producer() (Port, Action)
 	Consumers() iter.Seq2[Port, Action]
 }
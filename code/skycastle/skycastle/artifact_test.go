@@ -0,0 +1,64 @@
+package skycastle
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestWorkflowGraphNode_Validate(t *testing.T) {
+	tests := []struct {
+		name string
+		node WorkflowGraphNode
+		want error
+	}{
+		{"file", WorkflowGraphNode{Kind: ArtifactKindFile}, nil},
+		{"symlink", WorkflowGraphNode{Kind: ArtifactKindSymlink, LinkTarget: "lib.so.1"}, nil},
+		{"tar", WorkflowGraphNode{Kind: ArtifactKindArchive, ArchiveFormat: "tar"}, nil},
+		{"tar.gz", WorkflowGraphNode{Kind: ArtifactKindArchive, ArchiveFormat: "tar", Compression: "gzip"}, nil},
+		{"zip", WorkflowGraphNode{Kind: ArtifactKindArchive, ArchiveFormat: "zip"}, nil},
+		{"image", WorkflowGraphNode{Kind: ArtifactKindImage, ImageRef: "registry/app@sha256:abc"}, nil},
+
+		{"unknown kind", WorkflowGraphNode{Kind: ArtifactKind(99)}, ErrInvalidArtifactKind},
+		{"symlink without target", WorkflowGraphNode{Kind: ArtifactKindSymlink}, ErrInvalidArtifactMetadata},
+		{"archive without format", WorkflowGraphNode{Kind: ArtifactKindArchive}, ErrInvalidArtifactMetadata},
+		{"unknown compression", WorkflowGraphNode{Kind: ArtifactKindArchive, ArchiveFormat: "tar", Compression: "lz4"}, ErrInvalidArtifactMetadata},
+		{"compressed zip", WorkflowGraphNode{Kind: ArtifactKindArchive, ArchiveFormat: "zip", Compression: "xz"}, ErrInvalidArtifactMetadata},
+		{"image with space", WorkflowGraphNode{Kind: ArtifactKindImage, ImageRef: "app latest"}, ErrInvalidArtifactMetadata},
+		{"file with image ref", WorkflowGraphNode{Kind: ArtifactKindFile, ImageRef: "app"}, ErrInvalidArtifactMetadata},
+		{"directory with link target", WorkflowGraphNode{Kind: ArtifactKindDirectory, LinkTarget: "x"}, ErrInvalidArtifactMetadata},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.node.Validate()
+			if tt.want == nil && err != nil {
+				t.Fatalf("expected valid, got %v", err)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestDigest_CoversKindMetadata(t *testing.T) {
+	build := func(ref string) Digest {
+		b := NewWorkflowGraphBuilder()
+		act := b.AddAction("docker build")
+		img := b.AddImageArtifact(ref)
+		_ = b.AddOutput(act, Port("IMAGE"), img)
+
+		res, err := b.Build(Target{Path: Path[Relative, File]{path: "p"}, Name: "t"}, []ArtifactHandle{img}, nil)
+		return must(t, res, err).Digest()
+	}
+
+	if build("app:1") == build("app:2") {
+		t.Fatalf("expected the image reference to change the digest")
+	}
+
+	b := NewWorkflowGraphBuilder()
+	bad := b.AddArchiveArtifact("rar", "")
+	if _, err := b.Build(Target{Path: Path[Relative, File]{path: "p"}, Name: "t"}, []ArtifactHandle{bad}, nil); !errors.Is(err, ErrInvalidArtifactMetadata) {
+		t.Fatalf("expected Build to reject invalid metadata, got %v", err)
+	}
+}
@@ -3,7 +3,10 @@ package skycastle
 import (
 	"fmt"
 	"log/slog"
+	"maps"
+	"path/filepath"
 	"skycastle/skycastle/slice_extensions"
+	"slices"
 
 	"go.starlark.net/starlark"
 	"go.starlark.net/starlarkstruct"
@@ -97,7 +100,7 @@ func WorkflowBuiltin(packagePath Path[Relative, File], callback func(Workflow))
 
 				artifactIdS, ok := value.(starlark.String)
 				if !ok {
-					return nil, fmt.Errorf("input value for key %v is not a string: %v", key, value)
+					return nil, notAnArtifactError(fmt.Sprintf("input value for key %v", key), value)
 				}
 
 				artifactHandle, err := UniqueFromStarlarkString(artifactIdS)
@@ -147,15 +150,162 @@ func WorkflowBuiltin(packagePath Path[Relative, File], callback func(Workflow))
 	}
 }
 
-func FileBuiltin() StarlarkFunction {
-	return ArtifactBuiltin(ArtifactKindFile)
+// TargetBuiltin defines a named collection of actions. It is registered like
+// a workflow whose goals are every output of the member actions, so the
+// collection can be addressed as //path:name.
+func TargetBuiltin(packagePath Path[Relative, File], callback func(Workflow)) StarlarkFunction {
+	return func(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (val starlark.Value, err error) {
+		if len(args) > 0 {
+			err = fmt.Errorf("target() does not accept positional arguments")
+			return
+		}
+
+		local := thread.Local(workflowBuilderThreadLocalKey)
+		if local == nil {
+			err = fmt.Errorf("target() called outside of a workflow context")
+			return
+		}
+
+		b, ok := local.(*WorkflowGraphBuilder)
+		if !ok {
+			err = fmt.Errorf("invalid workflow builder in thread local")
+			return
+		}
+
+		var (
+			name        string
+			description string
+			actions     *starlark.List
+		)
+
+		if err = starlark.UnpackArgs("target", args, kwargs,
+			"name", &name,
+			"description?", &description,
+			"actions", &actions,
+		); err != nil {
+			return
+		}
+
+		if name == "" {
+			err = fmt.Errorf("target() requires a name")
+			return
+		}
+
+		var goalHandles []ArtifactHandle
+		iter := actions.Iterate()
+		defer iter.Done()
+
+		var actionVal starlark.Value
+		for iter.Next(&actionVal) {
+			handles, err := actionOutputHandles(actionVal)
+			if err != nil {
+				return nil, fmt.Errorf("target %s: %w", name, err)
+			}
+			goalHandles = append(goalHandles, handles...)
+		}
+
+		workflowOpts := []WorkflowSpecOption{}
+		if description != "" {
+			workflowOpts = append(workflowOpts, WithWorkflowDescription(description))
+		}
+
+		workflow, err := b.Build(
+			Target{
+				Path: packagePath,
+				Name: name,
+			},
+			goalHandles,
+			nil,
+			workflowOpts...,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build target: %w", err)
+		}
+
+		slog.Debug("Created target",
+			"name", name,
+			"actions", actions.Len(),
+		)
+
+		callback(workflow)
+		val = starlark.None
+		return
+	}
 }
 
-func DirBuiltin() StarlarkFunction {
-	return ArtifactBuiltin(ArtifactKindDirectory)
+// actionOutputHandles returns the stdout, stderr and declared outputs of an
+// action() result. An action skipped with when=False has none.
+func actionOutputHandles(value starlark.Value) ([]ArtifactHandle, error) {
+	action, ok := value.(*starlarkstruct.Struct)
+	if !ok || action.Constructor() != starlark.String("action") {
+		return nil, fmt.Errorf("actions must be action() results, got %s", value.Type())
+	}
+
+	if skipped, err := action.Attr("skipped"); err == nil && skipped == starlark.True {
+		return nil, nil
+	}
+
+	var values []starlark.Value
+	for _, field := range []string{"stdout", "stderr"} {
+		v, err := action.Attr(field)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+
+	outputs, err := action.Attr("outputs")
+	if err != nil {
+		return nil, err
+	}
+	outputsDict, ok := outputs.(*starlark.Dict)
+	if !ok {
+		return nil, fmt.Errorf("action outputs must be a dict, got %s", outputs.Type())
+	}
+	for _, item := range outputsDict.Items() {
+		values = append(values, item[1])
+	}
+
+	handles := make([]ArtifactHandle, 0, len(values))
+	for _, v := range values {
+		s, ok := v.(starlark.String)
+		if !ok {
+			return nil, fmt.Errorf("action output is not a string: %v", v)
+		}
+		handle, err := UniqueFromStarlarkString(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid action output handle: %w", err)
+		}
+		handles = append(handles, ArtifactHandle(handle))
+	}
+	return handles, nil
+}
+
+func FileBuiltin(repoRoot Path[Absolute, Directory]) StarlarkFunction {
+	return ArtifactBuiltin(repoRoot, ArtifactKindFile)
+}
+
+func DirBuiltin(repoRoot Path[Absolute, Directory]) StarlarkFunction {
+	return ArtifactBuiltin(repoRoot, ArtifactKindDirectory)
+}
+
+// SymlinkBuiltin is symlink(target, ...), a link pointing at target.
+func SymlinkBuiltin(repoRoot Path[Absolute, Directory]) StarlarkFunction {
+	return ArtifactBuiltin(repoRoot, ArtifactKindSymlink)
 }
 
-func ArtifactBuiltin(kind ArtifactKind) StarlarkFunction {
+// ArchiveBuiltin is archive(archive_format, compression?, ...), a tar or zip
+// archive.
+func ArchiveBuiltin(repoRoot Path[Absolute, Directory]) StarlarkFunction {
+	return ArtifactBuiltin(repoRoot, ArtifactKindArchive)
+}
+
+// ImageBuiltin is image(ref, ...), an OCI container image.
+func ImageBuiltin(repoRoot Path[Absolute, Directory]) StarlarkFunction {
+	return ArtifactBuiltin(repoRoot, ArtifactKindImage)
+}
+
+func ArtifactBuiltin(repoRoot Path[Absolute, Directory], kind ArtifactKind) StarlarkFunction {
 	return func(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (val starlark.Value, err error) {
 		if len(args) > 0 {
 			err = fmt.Errorf("artifact() does not accept positional arguments")
@@ -175,20 +325,63 @@ func ArtifactBuiltin(kind ArtifactKind) StarlarkFunction {
 		}
 
 		var (
-			description string
+			description   string
+			path          string
+			format        string
+			target        string
+			archiveFormat string
+			compression   string
+			ref           string
 		)
 
-		if err = starlark.UnpackArgs("artifact", args, kwargs,
+		pairs := []any{
 			"description?", &description,
-		); err != nil {
+			"path?", &path,
+			"format?", &format,
+		}
+		switch kind {
+		case ArtifactKindSymlink:
+			pairs = append(pairs, "target", &target)
+		case ArtifactKindArchive:
+			pairs = append(pairs, "archive_format", &archiveFormat, "compression?", &compression)
+		case ArtifactKindImage:
+			pairs = append(pairs, "ref", &ref)
+		}
+
+		if err = starlark.UnpackArgs("artifact", args, kwargs, pairs...); err != nil {
 			return
 		}
 
-		artifactOpts := []ArtifactOption{}
+		artifactOpts := []ArtifactOption{
+			WithLinkTarget(target),
+			WithArchive(archiveFormat, compression),
+			WithImageRef(ref),
+		}
 		if description != "" {
 			artifactOpts = append(artifactOpts, WithArtifactDescription(description))
 		}
 
+		if format != "" {
+			artifactOpts = append(artifactOpts, WithArtifactFormat(format))
+		}
+
+		if path != "" {
+			var label string
+			label, err = CanonicalizeLabel(repoRoot.String(), path)
+			if err != nil {
+				return
+			}
+			artifactOpts = append(artifactOpts, WithArtifactPath(label))
+		}
+
+		node := WorkflowGraphNode{Kind: kind}
+		for _, opt := range artifactOpts {
+			opt(&node)
+		}
+		if err = node.Validate(); err != nil {
+			return
+		}
+
 		artifactHandle := b.AddArtifact(kind, artifactOpts...)
 
 		val = Unique(artifactHandle).StarlarkString()
@@ -196,6 +389,37 @@ func ArtifactBuiltin(kind ArtifactKind) StarlarkFunction {
 	}
 }
 
+// actionInputPairs returns the (name, artifact) pairs of action()'s inputs
+// argument. A dict gives unordered inputs; a list of (name, artifact) pairs
+// also declares their positional order.
+func actionInputPairs(value starlark.Value) ([][2]starlark.Value, bool, error) {
+	switch value := value.(type) {
+	case nil, starlark.NoneType:
+		return nil, false, nil
+
+	case *starlark.Dict:
+		var pairs [][2]starlark.Value
+		for _, item := range value.Items() {
+			pairs = append(pairs, [2]starlark.Value{item[0], item[1]})
+		}
+		return pairs, false, nil
+
+	case *starlark.List:
+		var pairs [][2]starlark.Value
+		for i := range value.Len() {
+			pair, ok := value.Index(i).(starlark.Tuple)
+			if !ok || len(pair) != 2 {
+				return nil, false, fmt.Errorf("inputs[%d] must be a (name, artifact) pair, got %s", i, value.Index(i).Type())
+			}
+			pairs = append(pairs, [2]starlark.Value{pair[0], pair[1]})
+		}
+		return pairs, true, nil
+
+	default:
+		return nil, false, fmt.Errorf("inputs must be a dict or a list of (name, artifact) pairs, got %s", value.Type())
+	}
+}
+
 func ActionBuiltin() StarlarkFunction {
 	return func(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
 		if len(args) > 0 {
@@ -216,18 +440,28 @@ func ActionBuiltin() StarlarkFunction {
 			description string
 			command     string
 			policyDict  *starlark.Dict
-			inputsDict  *starlark.Dict
+			inputsValue starlark.Value
 			outputsDict *starlark.Dict
 			envDict     *starlark.Dict
+			depsList    *starlark.List
+			noCache     bool
+			workingDir  string
+			annotations *starlark.Dict
+			when        = true
 		)
 
 		if err := starlark.UnpackArgs("action", args, kwargs,
 			"description?", &description,
 			"command", &command,
 			"policy?", &policyDict,
-			"inputs?", &inputsDict,
+			"inputs?", &inputsValue,
 			"outputs?", &outputsDict,
 			"env?", &envDict,
+			"deps?", &depsList,
+			"no_cache?", &noCache,
+			"working_dir?", &workingDir,
+			"annotations?", &annotations,
+			"when?", &when,
 		); err != nil {
 			return nil, err
 		}
@@ -236,11 +470,20 @@ func ActionBuiltin() StarlarkFunction {
 			return nil, fmt.Errorf("action() requires a command")
 		}
 
+		if !when {
+			slog.Debug("Skipped action", "description", description)
+			return skippedAction(description, command, outputsDict)
+		}
+
 		var actionOpts []ActionOption
 		if description != "" {
 			actionOpts = append(actionOpts, WithActionDescription(description))
 		}
 
+		if noCache {
+			actionOpts = append(actionOpts, WithNoCache(true))
+		}
+
 		if policyDict != nil {
 			policy, err := PolicyFromStarlarkDict(policyDict)
 			if err != nil {
@@ -251,103 +494,101 @@ func ActionBuiltin() StarlarkFunction {
 		}
 
 		if envDict != nil {
-			env := make(map[string]string)
-			iter := envDict.Iterate()
-			defer iter.Done()
-
-			var key starlark.Value
-			for iter.Next(&key) {
-				name, ok := key.(starlark.String)
-				if !ok {
-					return nil, fmt.Errorf("env var names must be strings")
-				}
-
-				value, ok, err := envDict.Get(key)
-				if err != nil {
-					return nil, err
-				}
-				if !ok {
-					return nil, fmt.Errorf("env var key not found: %v", key)
-				}
+			env, err := stringMapFromStarlarkDict("env var", envDict)
+			if err != nil {
+				return nil, err
+			}
+			actionOpts = append(actionOpts, WithEnv(env))
+		}
 
-				valueStr, ok := value.(starlark.String)
-				if !ok {
-					return nil, fmt.Errorf("env var value for key %v is not a string: %v", key, value)
-				}
+		if workingDir != "" {
+			if !filepath.IsLocal(workingDir) {
+				return nil, fmt.Errorf("working_dir must be a relative path inside the repository, got %q", workingDir)
+			}
+			if dir := filepath.ToSlash(filepath.Clean(workingDir)); dir != "." {
+				actionOpts = append(actionOpts, WithWorkingDir(dir))
+			}
+		}
 
-				env[name.GoString()] = valueStr.GoString()
+		if annotations != nil {
+			values, err := stringMapFromStarlarkDict("annotation", annotations)
+			if err != nil {
+				return nil, err
 			}
+			actionOpts = append(actionOpts, WithAnnotations(values))
+		}
 
-			actionOpts = append(actionOpts, WithEnv(env))
+		inputPairs, ordered, err := actionInputPairs(inputsValue)
+		if err != nil {
+			return nil, err
 		}
 
-		action := b.AddAction(
-			command,
-			actionOpts...,
-		)
+		spec := ActionIO{
+			Inputs:  make(map[Port]ArtifactHandle),
+			Outputs: make(map[Port]ArtifactHandle),
+			OutputFiles: map[Port][]ArtifactOption{
+				"@stdout": {WithArtifactDescription("stdout")},
+				"@stderr": {WithArtifactDescription("stderr")},
+			},
+		}
+		var order []Port
+		for _, pair := range inputPairs {
+			key, value := pair[0], pair[1]
+			name, ok := key.(starlark.String)
+			if !ok {
+				return nil, fmt.Errorf("input names must be strings")
+			}
 
-		slog.Debug("Created action",
-			"description", description,
-			"handle", Unique(action).Short(),
-		)
+			artifactIdS, ok := value.(starlark.String)
+			if !ok {
+				return nil, notAnArtifactError(fmt.Sprintf("input value for key %v", key), value)
+			}
 
-		stdoutArtifactHandle, _ := b.AddOutputFile(
-			action,
-			"@stdout",
-			WithArtifactDescription("stdout"))
+			artifactHandle, err := UniqueFromStarlarkString(artifactIdS)
+			if err != nil {
+				return nil, fmt.Errorf("invalid handle for key %v: %v", key, err)
+			}
 
-		stderrArtifactHandle, _ := b.AddOutputFile(
-			action,
-			"@stderr",
-			WithArtifactDescription("stderr"))
+			port, err := PortFromStarlarkString(name)
+			if err != nil {
+				return nil, err
+			}
 
-		if inputsDict != nil {
-			iter := inputsDict.Iterate()
-			defer iter.Done()
+			if _, ok := spec.Inputs[port]; ok {
+				return nil, fmt.Errorf("input %v is given more than once", key)
+			}
 
-			var key starlark.Value
-			for iter.Next(&key) {
-				name, ok := key.(starlark.String)
-				if !ok {
-					return nil, fmt.Errorf("input names must be strings")
-				}
+			spec.Inputs[port] = ArtifactHandle(artifactHandle)
+			order = append(order, port)
+		}
+		if ordered {
+			spec.InputOrder = order
+		}
 
-				value, ok, err := inputsDict.Get(key)
-				if err != nil {
-					return nil, err
-				}
-				if !ok {
-					return nil, fmt.Errorf("input key not found: %v", key)
-				}
+		if depsList != nil {
+			iter := depsList.Iterate()
+			defer iter.Done()
 
-				artifactIdS, ok := value.(starlark.String)
+			var depVal starlark.Value
+			for iter.Next(&depVal) {
+				depS, ok := depVal.(starlark.String)
 				if !ok {
-					return nil, fmt.Errorf("input value for key %v is not a string: %v", key, value)
+					return nil, notAnArtifactError("dep", depVal)
 				}
 
-				artifactHandle, err := UniqueFromStarlarkString(artifactIdS)
+				artifactHandle, err := UniqueFromStarlarkString(depS)
 				if err != nil {
-					return nil, fmt.Errorf("invalid handle for key %v: %v", key, err)
-				}
-
-				port, err := PortFromStarlarkString(name)
-				if err != nil {
-					return nil, err
+					return nil, fmt.Errorf("invalid dep handle: %w", err)
 				}
 
-				slog.Debug("Added input to action",
-					"action", Unique(action).Short(),
-					"port", port,
-					"artifact", Unique(ArtifactHandle(artifactHandle)).Short(),
-				)
-				b.AddInput(action, port, ArtifactHandle(artifactHandle))
+				spec.Deps = append(spec.Deps, ArtifactHandle(artifactHandle))
 			}
 		}
 
-		var outputs *starlark.Dict
-
+		outputs := starlark.NewDict(0)
 		if outputsDict != nil {
 			outputs = starlark.NewDict(outputsDict.Len())
+			outputValues := make(map[Port]starlark.Value, outputsDict.Len())
 			iter := outputsDict.Iterate()
 			defer iter.Done()
 
@@ -381,28 +622,50 @@ func ActionBuiltin() StarlarkFunction {
 					return nil, err
 				}
 
-				slog.Debug("Added output to action",
-					"action", Unique(action).Short(),
-					"port", port,
-					"artifact", Unique(ArtifactHandle(artifactHandle)).Short(),
-				)
-				err = b.AddOutput(action, port, ArtifactHandle(artifactHandle))
-				if err != nil {
-					return nil, fmt.Errorf("failed to add output for key %v: %v", key, err)
-				}
+				spec.Outputs[port] = ArtifactHandle(artifactHandle)
+				outputValues[port] = value
+			}
 
-				outputs.SetKey(key, value)
+			// Insert in port order so iterating the returned outputs is
+			// deterministic regardless of how the caller built the dict.
+			for _, port := range slices.Sorted(maps.Keys(outputValues)) {
+				outputs.SetKey(port.StarlarkString(), outputValues[port])
 			}
-		} else {
-			outputs = starlark.NewDict(0)
+		}
+
+		// Everything is wired in one step, so an action that fails to wire
+		// leaves nothing behind in the graph.
+		action, files, err := b.AddActionWithIO(command, spec, actionOpts...)
+		if err != nil {
+			return nil, err
+		}
+
+		slog.Debug("Created action",
+			"description", description,
+			"handle", Unique(action).Short(),
+		)
+		for _, port := range slices.Sorted(maps.Keys(spec.Inputs)) {
+			slog.Debug("Added input to action",
+				"action", Unique(action).Short(),
+				"port", port,
+				"artifact", Unique(spec.Inputs[port]).Short(),
+			)
+		}
+		for _, port := range slices.Sorted(maps.Keys(spec.Outputs)) {
+			slog.Debug("Added output to action",
+				"action", Unique(action).Short(),
+				"port", port,
+				"artifact", Unique(spec.Outputs[port]).Short(),
+			)
 		}
 
 		val := starlarkstruct.FromStringDict(
 			starlark.String("action"),
 			starlark.StringDict{
 				"outputs": outputs,
-				"stdout":  Unique(stdoutArtifactHandle).StarlarkString(),
-				"stderr":  Unique(stderrArtifactHandle).StarlarkString(),
+				"stdout":  Unique(files["@stdout"]).StarlarkString(),
+				"stderr":  Unique(files["@stderr"]).StarlarkString(),
+				"skipped": starlark.False,
 			},
 		)
 
@@ -410,6 +673,75 @@ func ActionBuiltin() StarlarkFunction {
 	}
 }
 
+// skippedOutput stands in for an output of an action skipped with
+// when=False. It is not an artifact handle, so passing it on to another
+// action fails with an error naming the skipped action.
+type skippedOutput struct {
+	action string
+	port   Port
+}
+
+var _ starlark.Value = skippedOutput{}
+
+func (o skippedOutput) String() string {
+	return fmt.Sprintf("<skipped output %s of %s>", o.port, o.action)
+}
+
+func (o skippedOutput) Type() string {
+	return "skipped_output"
+}
+
+func (o skippedOutput) Freeze() {}
+
+func (o skippedOutput) Truth() starlark.Bool {
+	return starlark.False
+}
+
+func (o skippedOutput) Hash() (uint32, error) {
+	return starlark.String(o.String()).Hash()
+}
+
+// skippedAction returns the result of an action() call with when=False. It
+// registers nothing in the graph but has the same shape as a real action, with
+// placeholders in place of its outputs.
+func skippedAction(description, command string, outputsDict *starlark.Dict) (starlark.Value, error) {
+	name := description
+	if name == "" {
+		name = command
+	}
+
+	outputs := starlark.NewDict(0)
+	if outputsDict != nil {
+		ports := make([]Port, 0, outputsDict.Len())
+		for _, item := range outputsDict.Items() {
+			key, ok := item[0].(starlark.String)
+			if !ok {
+				return nil, fmt.Errorf("output names must be strings")
+			}
+			port, err := PortFromStarlarkString(key)
+			if err != nil {
+				return nil, err
+			}
+			ports = append(ports, port)
+		}
+
+		slices.Sort(ports)
+		for _, port := range ports {
+			outputs.SetKey(port.StarlarkString(), skippedOutput{action: name, port: port})
+		}
+	}
+
+	return starlarkstruct.FromStringDict(
+		starlark.String("action"),
+		starlark.StringDict{
+			"outputs": outputs,
+			"stdout":  skippedOutput{action: name, port: "@stdout"},
+			"stderr":  skippedOutput{action: name, port: "@stderr"},
+			"skipped": starlark.True,
+		},
+	), nil
+}
+
 func PolicyBuiltin() StarlarkFunction {
 	return func(_ *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (val starlark.Value, err error) {
 		policy := Policy{}
@@ -443,3 +775,43 @@ func PolicyBuiltin() StarlarkFunction {
 		return
 	}
 }
+
+// stringMapFromStarlarkDict converts a dict of strings to strings, such as
+// an action's env, naming what its entries are in errors.
+func stringMapFromStarlarkDict(what string, dict *starlark.Dict) (map[string]string, error) {
+	values := make(map[string]string, dict.Len())
+	for _, item := range dict.Items() {
+		key, value := item[0], item[1]
+		name, ok := key.(starlark.String)
+		if !ok {
+			return nil, fmt.Errorf("%s names must be strings", what)
+		}
+
+		valueStr, ok := value.(starlark.String)
+		if !ok {
+			return nil, fmt.Errorf("%s value for key %v is not a string: %v", what, key, value)
+		}
+
+		values[name.GoString()] = valueStr.GoString()
+	}
+	return values, nil
+}
+
+// notAnArtifactError reports a value passed where an artifact handle was
+// expected, calling out the common mistakes of passing an action() result
+// instead of one of its outputs, or file/dir without calling them.
+func notAnArtifactError(what string, value starlark.Value) error {
+	switch v := value.(type) {
+	case skippedOutput:
+		return fmt.Errorf("%s: output %s of action %q was skipped by when=False; guard this use with the same condition", what, v.port, v.action)
+	case *starlarkstruct.Struct:
+		if v.Constructor() == starlark.String("action") {
+			return fmt.Errorf("%s: you passed an action() where an artifact is expected; did you mean to use one of its outputs, e.g. .outputs[\"NAME\"] or .stdout?", what)
+		}
+	case *starlark.Builtin:
+		if slices.Contains([]string{"file", "dir", "symlink", "archive", "image"}, v.Name()) {
+			return fmt.Errorf("%s: you passed %s where an artifact is expected; did you mean to call it, %s()?", what, v.Name(), v.Name())
+		}
+	}
+	return fmt.Errorf("%s is not a string: %v", what, value)
+}
@@ -0,0 +1,491 @@
+package skycastle
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"go.starlark.net/syntax"
+)
+
+// newBuiltinThread returns a Starlark thread carrying a fresh workflow builder,
+// as the package worker sets up before executing a file.
+func newBuiltinThread() (*starlark.Thread, *WorkflowGraphBuilder) {
+	b := NewWorkflowGraphBuilder()
+	thread := &starlark.Thread{Name: "test"}
+	thread.SetLocal(workflowBuilderThreadLocalKey, b)
+	return thread, b
+}
+
+func testRepoRoot(t *testing.T) Path[Absolute, Directory] {
+	t.Helper()
+	repoRoot, err := ParseAbsoluteDirectory("/repo")
+	if err != nil {
+		t.Fatalf("ParseAbsoluteDirectory: %v", err)
+	}
+	return repoRoot
+}
+
+// artifactNode resolves the graph node behind an artifact handle returned by
+// a builtin.
+func artifactNode(t *testing.T, b *WorkflowGraphBuilder, val starlark.Value) WorkflowGraphNode {
+	t.Helper()
+
+	handleS, ok := val.(starlark.String)
+	if !ok {
+		t.Fatalf("expected artifact handle string, got %s", val.Type())
+	}
+
+	handle, err := UniqueFromStarlarkString(handleS)
+	if err != nil {
+		t.Fatalf("UniqueFromStarlarkString: %v", err)
+	}
+
+	id, ok := b.ArtifactHandles[ArtifactHandle(handle)]
+	if !ok {
+		t.Fatalf("unknown artifact handle %s", handleS)
+	}
+
+	return b.Cospan.Apex.Nodes[id]
+}
+
+func TestFileBuiltin_CanonicalPath(t *testing.T) {
+	thread, b := newBuiltinThread()
+	file := starlark.NewBuiltin("file", FileBuiltin(testRepoRoot(t)))
+
+	val, err := starlark.Call(thread, file, nil, []starlark.Tuple{
+		{starlark.String("path"), starlark.String("./src/foo/")},
+	})
+	if err != nil {
+		t.Fatalf("file(): %v", err)
+	}
+
+	node := artifactNode(t, b, val)
+	if node.Kind != ArtifactKindFile {
+		t.Fatalf("expected file kind, got %s", node.Kind)
+	}
+	if node.Path != "src/foo" {
+		t.Fatalf("expected path %q, got %q", "src/foo", node.Path)
+	}
+}
+
+func TestFileBuiltin_Format(t *testing.T) {
+	thread, b := newBuiltinThread()
+	file := starlark.NewBuiltin("file", FileBuiltin(testRepoRoot(t)))
+
+	val, err := starlark.Call(thread, file, nil, []starlark.Tuple{
+		{starlark.String("format"), starlark.String("tar")},
+	})
+	if err != nil {
+		t.Fatalf("file(): %v", err)
+	}
+
+	if node := artifactNode(t, b, val); node.Format != "tar" {
+		t.Fatalf("expected format %q, got %q", "tar", node.Format)
+	}
+}
+
+func TestDirBuiltin_WithoutPath(t *testing.T) {
+	thread, b := newBuiltinThread()
+	dir := starlark.NewBuiltin("dir", DirBuiltin(testRepoRoot(t)))
+
+	val, err := starlark.Call(thread, dir, nil, nil)
+	if err != nil {
+		t.Fatalf("dir(): %v", err)
+	}
+
+	node := artifactNode(t, b, val)
+	if node.Kind != ArtifactKindDirectory {
+		t.Fatalf("expected directory kind, got %s", node.Kind)
+	}
+	if node.Path != "" {
+		t.Fatalf("expected empty path, got %q", node.Path)
+	}
+}
+
+func TestFileBuiltin_RejectsEscapingPath(t *testing.T) {
+	thread, _ := newBuiltinThread()
+	file := starlark.NewBuiltin("file", FileBuiltin(testRepoRoot(t)))
+
+	_, err := starlark.Call(thread, file, nil, []starlark.Tuple{
+		{starlark.String("path"), starlark.String("../outside")},
+	})
+	if !errors.Is(err, ErrLabelEscapesRepoRoot) {
+		t.Fatalf("expected ErrLabelEscapesRepoRoot, got %v", err)
+	}
+}
+
+func TestKindBuiltins_RecordMetadata(t *testing.T) {
+	thread, b := newBuiltinThread()
+	call := func(name string, fn StarlarkFunction, kwargs ...starlark.Tuple) WorkflowGraphNode {
+		t.Helper()
+		val, err := starlark.Call(thread, starlark.NewBuiltin(name, fn), nil, kwargs)
+		if err != nil {
+			t.Fatalf("%s(): %v", name, err)
+		}
+		return artifactNode(t, b, val)
+	}
+
+	link := call("symlink", SymlinkBuiltin(testRepoRoot(t)),
+		starlark.Tuple{starlark.String("target"), starlark.String("../lib/libfoo.so.1")})
+	if link.Kind != ArtifactKindSymlink || link.LinkTarget != "../lib/libfoo.so.1" {
+		t.Fatalf("unexpected symlink %+v", link)
+	}
+
+	tarball := call("archive", ArchiveBuiltin(testRepoRoot(t)),
+		starlark.Tuple{starlark.String("archive_format"), starlark.String("tar")},
+		starlark.Tuple{starlark.String("compression"), starlark.String("zstd")})
+	if tarball.Kind != ArtifactKindArchive || tarball.ArchiveFormat != "tar" || tarball.Compression != "zstd" {
+		t.Fatalf("unexpected archive %+v", tarball)
+	}
+
+	img := call("image", ImageBuiltin(testRepoRoot(t)),
+		starlark.Tuple{starlark.String("ref"), starlark.String("ghcr.io/example/app:1.2")})
+	if img.Kind != ArtifactKindImage || img.ImageRef != "ghcr.io/example/app:1.2" {
+		t.Fatalf("unexpected image %+v", img)
+	}
+}
+
+func TestArchiveBuiltin_RejectsInvalidMetadata(t *testing.T) {
+	for name, kwargs := range map[string][]starlark.Tuple{
+		"unknown format": {{starlark.String("archive_format"), starlark.String("rar")}},
+		"zip compression": {
+			{starlark.String("archive_format"), starlark.String("zip")},
+			{starlark.String("compression"), starlark.String("gzip")},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			thread, b := newBuiltinThread()
+			archive := starlark.NewBuiltin("archive", ArchiveBuiltin(testRepoRoot(t)))
+
+			if _, err := starlark.Call(thread, archive, nil, kwargs); !errors.Is(err, ErrInvalidArtifactMetadata) {
+				t.Fatalf("expected ErrInvalidArtifactMetadata, got %v", err)
+			}
+			if len(b.Cospan.Apex.Nodes) != 0 {
+				t.Fatalf("expected no artifact to be added")
+			}
+		})
+	}
+}
+
+func TestActionBuiltin_OutputsInPortOrder(t *testing.T) {
+	for _, order := range [][]string{
+		{"ZETA", "ALPHA", "MU"},
+		{"MU", "ZETA", "ALPHA"},
+		{"ALPHA", "MU", "ZETA"},
+	} {
+		thread, b := newBuiltinThread()
+		action := starlark.NewBuiltin("action", ActionBuiltin())
+
+		outputsDict := starlark.NewDict(len(order))
+		for _, port := range order {
+			handle := b.AddFileArtifact()
+			outputsDict.SetKey(starlark.String(port), Unique(handle).StarlarkString())
+		}
+
+		val, err := starlark.Call(thread, action, nil, []starlark.Tuple{
+			{starlark.String("command"), starlark.String("true")},
+			{starlark.String("outputs"), outputsDict},
+		})
+		if err != nil {
+			t.Fatalf("action(): %v", err)
+		}
+
+		outputsVal, err := val.(*starlarkstruct.Struct).Attr("outputs")
+		if err != nil {
+			t.Fatalf("outputs: %v", err)
+		}
+
+		var got []string
+		for _, key := range outputsVal.(*starlark.Dict).Keys() {
+			got = append(got, string(key.(starlark.String)))
+		}
+
+		if want := []string{"ALPHA", "MU", "ZETA"}; !slices.Equal(got, want) {
+			t.Fatalf("declared order %v: got outputs %v, want %v", order, got, want)
+		}
+	}
+}
+
+func TestActionBuiltin_HelpfulErrorForNonArtifactInputs(t *testing.T) {
+	thread, _ := newBuiltinThread()
+	action := starlark.NewBuiltin("action", ActionBuiltin())
+	file := starlark.NewBuiltin("file", FileBuiltin(testRepoRoot(t)))
+
+	producer, err := starlark.Call(thread, action, nil, []starlark.Tuple{
+		{starlark.String("command"), starlark.String("true")},
+	})
+	if err != nil {
+		t.Fatalf("action(): %v", err)
+	}
+
+	cases := map[string]struct {
+		value starlark.Value
+		want  string
+	}{
+		"action_result": {
+			value: producer,
+			want:  "you passed an action() where an artifact is expected; did you mean to use one of its outputs",
+		},
+		"uncalled_file": {
+			value: file,
+			want:  "you passed file where an artifact is expected; did you mean to call it, file()?",
+		},
+		"int": {
+			value: starlark.MakeInt(0),
+			want:  "input value for key \"IN\" is not a string: 0",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			inputs := starlark.NewDict(1)
+			inputs.SetKey(starlark.String("IN"), tc.value)
+
+			_, err := starlark.Call(thread, action, nil, []starlark.Tuple{
+				{starlark.String("command"), starlark.String("true")},
+				{starlark.String("inputs"), inputs},
+			})
+			if err == nil {
+				t.Fatalf("expected an error")
+			}
+			if !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("expected error containing %q, got %q", tc.want, err.Error())
+			}
+		})
+	}
+}
+
+func TestTargetBuiltin_ResolvesMemberActions(t *testing.T) {
+	thread, _ := newBuiltinThread()
+	action := starlark.NewBuiltin("action", ActionBuiltin())
+
+	var actions []starlark.Value
+	for _, command := range []string{"make", "make test"} {
+		val, err := starlark.Call(thread, action, nil, []starlark.Tuple{
+			{starlark.String("command"), starlark.String(command)},
+		})
+		if err != nil {
+			t.Fatalf("action(): %v", err)
+		}
+		actions = append(actions, val)
+	}
+
+	var defined Workflow
+	target := starlark.NewBuiltin("target", TargetBuiltin(Path[Relative, File]{path: "app"}, func(wf Workflow) {
+		defined = wf
+	}))
+
+	if _, err := starlark.Call(thread, target, nil, []starlark.Tuple{
+		{starlark.String("name"), starlark.String("release")},
+		{starlark.String("actions"), starlark.NewList(actions)},
+	}); err != nil {
+		t.Fatalf("target(): %v", err)
+	}
+
+	if defined == nil {
+		t.Fatal("expected target() to define a workflow")
+	}
+	if got := defined.Target().String(); got != "//app:release" {
+		t.Fatalf("expected target //app:release, got %s", got)
+	}
+
+	var commands []string
+	for goal := range defined.Goals() {
+		_, producer := goal.Producer()
+		if producer == nil {
+			t.Fatalf("expected every goal to be produced by a member action")
+		}
+		if !slices.Contains(commands, producer.Command()) {
+			commands = append(commands, producer.Command())
+		}
+	}
+	slices.Sort(commands)
+	if !slices.Equal(commands, []string{"make", "make test"}) {
+		t.Fatalf("expected member actions [make, make test], got %v", commands)
+	}
+
+	if _, err := starlark.Call(thread, target, nil, []starlark.Tuple{
+		{starlark.String("name"), starlark.String("bad")},
+		{starlark.String("actions"), starlark.NewList([]starlark.Value{starlark.String("x")})},
+	}); err == nil {
+		t.Fatal("expected target() to reject non-action members")
+	}
+}
+
+func TestActionBuiltin_When(t *testing.T) {
+	src := `
+out = file()
+gen = action(command = "gen", outputs = {"OUT": out}, when = enabled)
+skipped = gen.skipped
+`
+
+	for _, enabled := range []bool{true, false} {
+		t.Run(fmt.Sprintf("enabled=%v", enabled), func(t *testing.T) {
+			thread, b := newBuiltinThread()
+			predeclared := starlark.StringDict{
+				"action":  starlark.NewBuiltin("action", ActionBuiltin()),
+				"file":    starlark.NewBuiltin("file", FileBuiltin(testRepoRoot(t))),
+				"enabled": starlark.Bool(enabled),
+			}
+
+			globals, err := starlark.ExecFileOptions(&syntax.FileOptions{}, thread, "when.star", src, predeclared)
+			if err != nil {
+				t.Fatalf("exec: %v", err)
+			}
+
+			wantActions := 0
+			if enabled {
+				wantActions = 1
+			}
+			if got := len(b.Cospan.Apex.Edges); got != wantActions {
+				t.Fatalf("expected %d actions in the graph, got %d", wantActions, got)
+			}
+			if globals["skipped"] != starlark.Bool(!enabled) {
+				t.Fatalf("expected skipped = %v, got %v", !enabled, globals["skipped"])
+			}
+		})
+	}
+}
+
+func TestActionBuiltin_OrderedInputs(t *testing.T) {
+	src := `
+z, a, m = file(), file(), file()
+action(command = "cat $1 $2 $3", inputs = [("Z", z), ("A", a), ("M", m)])
+`
+
+	thread, b := newBuiltinThread()
+	predeclared := starlark.StringDict{
+		"action": starlark.NewBuiltin("action", ActionBuiltin()),
+		"file":   starlark.NewBuiltin("file", FileBuiltin(testRepoRoot(t))),
+	}
+
+	if _, err := starlark.ExecFileOptions(&syntax.FileOptions{}, thread, "ordered.star", src, predeclared); err != nil {
+		t.Fatalf("exec: %v", err)
+	}
+
+	var edge WorkflowGraphEdge
+	for _, e := range b.Cospan.Apex.Edges {
+		edge = e
+	}
+	if want := []Port{"Z", "A", "M"}; !slices.Equal(edge.InputOrder, want) {
+		t.Fatalf("expected input order %v, got %v", want, edge.InputOrder)
+	}
+}
+
+func TestActionBuiltin_WorkingDirAndAnnotations(t *testing.T) {
+	src := `
+action(command = "npm test", working_dir = "web/./app", annotations = {"owner": "web"})
+`
+
+	thread, b := newBuiltinThread()
+	predeclared := starlark.StringDict{
+		"action": starlark.NewBuiltin("action", ActionBuiltin()),
+	}
+
+	if _, err := starlark.ExecFileOptions(&syntax.FileOptions{}, thread, "metadata.star", src, predeclared); err != nil {
+		t.Fatalf("exec: %v", err)
+	}
+
+	var edge WorkflowGraphEdge
+	for _, e := range b.Cospan.Apex.Edges {
+		edge = e
+	}
+	if edge.WorkingDir != "web/app" {
+		t.Fatalf("expected working dir web/app, got %q", edge.WorkingDir)
+	}
+	if edge.Annotations["owner"] != "web" {
+		t.Fatalf("expected owner annotation, got %v", edge.Annotations)
+	}
+
+	for _, dir := range []string{"../outside", "/abs"} {
+		thread, _ := newBuiltinThread()
+		src := fmt.Sprintf("action(command = \"true\", working_dir = %q)\n", dir)
+		_, err := starlark.ExecFileOptions(&syntax.FileOptions{}, thread, "metadata.star", src, predeclared)
+		if err == nil || !strings.Contains(err.Error(), "working_dir") {
+			t.Fatalf("expected working_dir %q to be rejected, got %v", dir, err)
+		}
+	}
+}
+
+func TestActionBuiltin_OrderedInputsRejectsMalformedPairs(t *testing.T) {
+	for name, inputs := range map[string]string{
+		"not a pair": `[file()]`,
+		"triple":     `[("A", file(), "extra")]`,
+		"repeated":   `[("A", file()), ("A", file())]`,
+		"not a list": `"A"`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			thread, _ := newBuiltinThread()
+			predeclared := starlark.StringDict{
+				"action": starlark.NewBuiltin("action", ActionBuiltin()),
+				"file":   starlark.NewBuiltin("file", FileBuiltin(testRepoRoot(t))),
+			}
+
+			src := "action(command = \"cat $1\", inputs = " + inputs + ")\n"
+			if _, err := starlark.ExecFileOptions(&syntax.FileOptions{}, thread, "ordered.star", src, predeclared); err == nil {
+				t.Fatalf("expected an error for inputs = %s", inputs)
+			}
+		})
+	}
+}
+
+func TestActionBuiltin_WhenSkippedOutputReferenced(t *testing.T) {
+	src := `
+gen = action(command = "gen", description = "generate", outputs = {"OUT": file()}, when = False)
+action(command = "use", inputs = {"IN": gen.outputs["OUT"]})
+`
+
+	thread, _ := newBuiltinThread()
+	predeclared := starlark.StringDict{
+		"action": starlark.NewBuiltin("action", ActionBuiltin()),
+		"file":   starlark.NewBuiltin("file", FileBuiltin(testRepoRoot(t))),
+	}
+
+	_, err := starlark.ExecFileOptions(&syntax.FileOptions{}, thread, "when.star", src, predeclared)
+	if err == nil {
+		t.Fatal("expected referencing a skipped output to fail")
+	}
+	want := `output OUT of action "generate" was skipped by when=False`
+	if !strings.Contains(err.Error(), want) {
+		t.Fatalf("expected error containing %q, got %q", want, err.Error())
+	}
+}
+
+func TestActionBuiltin_FailureLeavesGraphUnchanged(t *testing.T) {
+	thread, b := newBuiltinThread()
+	action := starlark.NewBuiltin("action", ActionBuiltin())
+	file := starlark.NewBuiltin("file", FileBuiltin(testRepoRoot(t)))
+
+	src, err := starlark.Call(thread, file, nil, []starlark.Tuple{
+		{starlark.String("path"), starlark.String("main.go")},
+	})
+	if err != nil {
+		t.Fatalf("file(): %v", err)
+	}
+
+	inputs := starlark.NewDict(1)
+	inputs.SetKey(starlark.String("SRC"), src)
+	outputs := starlark.NewDict(1)
+	outputs.SetKey(starlark.String("OUT"), src)
+
+	_, err = starlark.Call(thread, action, nil, []starlark.Tuple{
+		{starlark.String("command"), starlark.String("true")},
+		{starlark.String("inputs"), inputs},
+		{starlark.String("outputs"), outputs},
+	})
+	if !errors.Is(err, ErrSelfDependency) {
+		t.Fatalf("expected ErrSelfDependency, got %v", err)
+	}
+
+	if len(b.Cospan.Apex.Edges) != 0 {
+		t.Fatalf("expected no actions, got %d", len(b.Cospan.Apex.Edges))
+	}
+	if len(b.Cospan.Apex.Nodes) != 1 {
+		t.Fatalf("expected no stdout or stderr artifacts to be left behind, got %d artifacts", len(b.Cospan.Apex.Nodes))
+	}
+}
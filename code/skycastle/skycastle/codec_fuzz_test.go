@@ -0,0 +1,110 @@
+package skycastle
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"go.starlark.net/starlark"
+)
+
+func FuzzUniqueRoundTrip(f *testing.F) {
+	f.Add(make([]byte, 20))
+	f.Add(bytes.Repeat([]byte{0xff}, 20))
+	f.Add([]byte("skycastle-unique-seed"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var u Unique
+		copy(u[:], data)
+
+		decoded, err := UniqueFromStarlarkString(u.StarlarkString())
+		if err != nil {
+			t.Fatalf("decoding %q: %v", u.String(), err)
+		}
+		if decoded != u {
+			t.Fatalf("round trip mismatch: got %v, want %v", decoded, u)
+		}
+	})
+}
+
+func FuzzUniqueFromStarlarkString(f *testing.F) {
+	f.Add(NewUnique().String())
+	f.Add("")
+	f.Add("not a handle")
+	f.Add("AAAAAAAAAAAAAAAAAAAAAAAAAA_")
+
+	f.Fuzz(func(t *testing.T, s string) {
+		u, err := UniqueFromStarlarkString(starlark.String(s))
+		if err != nil {
+			return
+		}
+
+		again, err := UniqueFromStarlarkString(u.StarlarkString())
+		if err != nil {
+			t.Fatalf("re-decoding %q: %v", u.String(), err)
+		}
+		if again != u {
+			t.Fatalf("round trip mismatch for %q: got %v, want %v", s, again, u)
+		}
+	})
+}
+
+func FuzzParseTarget(f *testing.F) {
+	f.Add("//app/BUILD.star:release")
+	f.Add("//a.star:b")
+	f.Add("//:")
+	f.Add("app:release")
+
+	f.Fuzz(func(t *testing.T, s string) {
+		target, err := ParseTarget(s)
+		if err != nil {
+			return
+		}
+
+		again, err := ParseTarget(target.String())
+		if err != nil {
+			t.Fatalf("re-parsing %q (from %q): %v", target.String(), s, err)
+		}
+		if again != target {
+			t.Fatalf("round trip mismatch for %q: got %v, want %v", s, again, target)
+		}
+	})
+}
+
+func FuzzImportJSONL(f *testing.F) {
+	b := NewWorkflowGraphBuilder()
+	src := b.AddFileArtifact(WithArtifactPath("main.go"))
+	act := b.AddAction("go build", WithEnvVar("CGO_ENABLED", "0"))
+	_ = b.AddInput(act, Port("SRC"), src)
+	_, _ = b.AddOutputFile(act, Port("BIN"))
+
+	var seed bytes.Buffer
+	if err := b.Cospan.Apex.ExportJSONL(&seed); err != nil {
+		f.Fatalf("ExportJSONL: %v", err)
+	}
+
+	f.Add(seed.Bytes())
+	f.Add([]byte(""))
+	f.Add([]byte("{}\n"))
+	f.Add([]byte(`{"type":"edge","action":"x","artifact":"y","direction":"input"}`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		g, err := ImportJSONL(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+
+		var buf bytes.Buffer
+		if err := g.ExportJSONL(&buf); err != nil {
+			t.Fatalf("ExportJSONL of imported graph: %v", err)
+		}
+
+		again, err := ImportJSONL(&buf)
+		if err != nil {
+			t.Fatalf("ImportJSONL of exported graph: %v", err)
+		}
+		if !reflect.DeepEqual(again, g) {
+			t.Fatalf("round trip mismatch:\n got %+v\nwant %+v", again, g)
+		}
+	})
+}
@@ -0,0 +1,87 @@
+package skycastle
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
+)
+
+// ContentDigest returns the digest of what is at path. A file's digest is the
+// sha256 of its contents. A directory's digest covers every entry below it in
+// lexical order: its slash-separated relative path, its type, and the
+// contents of files or the targets of symlinks. Modification times and
+// permissions other than the executable bit are ignored, so identical trees
+// in different places have the same digest.
+func ContentDigest(path string) (Digest, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return Digest{}, err
+	}
+	if !info.IsDir() {
+		return fileDigest(path)
+	}
+
+	h := sha256.New()
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == path {
+			return nil
+		}
+		rel, err := filepath.Rel(path, p)
+		if err != nil {
+			return err
+		}
+
+		t := tuple.Tuple{filepath.ToSlash(rel)}
+		switch {
+		case d.IsDir():
+			t = append(t, "directory")
+		case d.Type()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			t = append(t, "symlink", target)
+		case d.Type().IsRegular():
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			fd, err := fileDigest(p)
+			if err != nil {
+				return err
+			}
+			t = append(t, "file", info.Mode()&0o111 != 0, fd[:])
+		default:
+			return fmt.Errorf("%s: unsupported file type %v", p, d.Type())
+		}
+
+		h.Write(t.Pack())
+		return nil
+	})
+	if err != nil {
+		return Digest{}, err
+	}
+	return digestSum(h), nil
+}
+
+func fileDigest(path string) (Digest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Digest{}, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return Digest{}, err
+	}
+	return digestSum(h), nil
+}
@@ -0,0 +1,66 @@
+package skycastle
+
+import (
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestContentDigest_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.txt")
+	if err := os.WriteFile(path, []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ContentDigest(path)
+	if err != nil {
+		t.Fatalf("ContentDigest: %v", err)
+	}
+	if want := Digest(sha256.Sum256([]byte("hello"))); got != want {
+		t.Fatalf("expected the sha256 of the contents, got %v", got)
+	}
+}
+
+func TestContentDigest_Directory(t *testing.T) {
+	tree := func(files map[string]string) string {
+		root := t.TempDir()
+		for name, contents := range files {
+			path := filepath.Join(root, name)
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return root
+	}
+	digest := func(root string) Digest {
+		d, err := ContentDigest(root)
+		if err != nil {
+			t.Fatalf("ContentDigest: %v", err)
+		}
+		return d
+	}
+
+	files := map[string]string{"a.txt": "a", "sub/b.txt": "b"}
+	a, b := tree(files), tree(files)
+	if digest(a) != digest(b) {
+		t.Fatalf("expected identical trees to have the same digest")
+	}
+
+	if digest(a) == digest(tree(map[string]string{"a.txt": "a", "sub/b.txt": "B"})) {
+		t.Fatalf("expected changed contents to change the digest")
+	}
+	if digest(a) == digest(tree(map[string]string{"a.txt": "a", "sub/c.txt": "b"})) {
+		t.Fatalf("expected a renamed file to change the digest")
+	}
+
+	if err := os.Chmod(filepath.Join(b, "a.txt"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if digest(a) == digest(b) {
+		t.Fatalf("expected the executable bit to change the digest")
+	}
+}
@@ -0,0 +1,131 @@
+package skycastle
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+var ErrStillReferenced = errors.New("still referenced")
+
+// DeleteAction removes an action together with the artifacts it produces,
+// and the handles to them. It changes nothing and returns ErrStillReferenced
+// if any of those artifacts is still used elsewhere in the graph.
+func (b *WorkflowGraphBuilder) DeleteAction(action ActionHandle) error {
+	actionId, ok := b.ActionHandles[action]
+	if !ok {
+		return ErrInvalidActionHandle
+	}
+
+	g := b.Cospan.Apex
+	outputs := slices.Collect(maps.Values(g.Edges[actionId].Outputs))
+	for _, artifactId := range outputs {
+		if err := b.checkUnreferenced(artifactId, actionId); err != nil {
+			return err
+		}
+	}
+
+	for _, artifactId := range outputs {
+		b.removeArtifact(artifactId)
+	}
+	delete(g.Edges, actionId)
+	b.index = nil
+	maps.DeleteFunc(b.ActionHandles, func(_ ActionHandle, id EdgeId) bool {
+		return id == actionId
+	})
+	return nil
+}
+
+// DeleteArtifact removes an artifact and the handles to it. It changes
+// nothing and returns ErrStillReferenced if an action still produces,
+// consumes or depends on the artifact, or it is exposed on the workflow's
+// boundary or as a workflow input.
+func (b *WorkflowGraphBuilder) DeleteArtifact(artifact ArtifactHandle) error {
+	artifactId, ok := b.ArtifactHandles[artifact]
+	if !ok {
+		return ErrInvalidArtifactHandle
+	}
+
+	if err := b.checkUnreferenced(artifactId, EdgeId{}); err != nil {
+		return err
+	}
+
+	b.removeArtifact(artifactId)
+	return nil
+}
+
+// checkUnreferenced reports the first use of an artifact by any action other
+// than except, or by the builder's boundary or inputs.
+func (b *WorkflowGraphBuilder) checkUnreferenced(artifactId NodeId, except EdgeId) error {
+	g := b.Cospan.Apex
+
+	for _, id := range sortedEdgeIds(g) {
+		if id == except {
+			continue
+		}
+		edge := g.Edges[id]
+		if slices.Contains(g.dependencies(id), artifactId) || slices.Contains(slices.Collect(maps.Values(edge.Outputs)), artifactId) {
+			return fmt.Errorf("%w: %s is used by %s", ErrStillReferenced, g.artifactLabel(artifactId), g.actionLabel(id))
+		}
+	}
+
+	for _, foot := range []Foot{b.Cospan.Left, b.Cospan.Right} {
+		if slices.Contains(slices.Collect(maps.Values(foot)), artifactId) {
+			return fmt.Errorf("%w: %s is exposed on the workflow boundary", ErrStillReferenced, g.artifactLabel(artifactId))
+		}
+	}
+
+	for port, id := range b.Inputs {
+		if id == artifactId {
+			return fmt.Errorf("%w: %s is workflow input %s", ErrStillReferenced, g.artifactLabel(artifactId), port)
+		}
+	}
+
+	return nil
+}
+
+func (b *WorkflowGraphBuilder) removeArtifact(artifactId NodeId) {
+	delete(b.Cospan.Apex.Nodes, artifactId)
+	maps.DeleteFunc(b.ArtifactHandles, func(_ ArtifactHandle, id NodeId) bool {
+		return id == artifactId
+	})
+}
+
+// GC removes every orphaned artifact: one that no action produces, consumes
+// or depends on, and that is neither exposed on the workflow's boundary nor
+// a workflow input. It returns how many artifacts were removed. Deleting an
+// action leaves its inputs behind, and GC is how they are cleaned up.
+func (b *WorkflowGraphBuilder) GC() int {
+	g := b.Cospan.Apex
+
+	referenced := make(map[NodeId]bool)
+	for id, edge := range g.Edges {
+		for _, artifactId := range g.dependencies(id) {
+			referenced[artifactId] = true
+		}
+		for _, artifactId := range edge.Outputs {
+			referenced[artifactId] = true
+		}
+	}
+	for _, foot := range []Foot{b.Cospan.Left, b.Cospan.Right} {
+		for _, artifactId := range foot {
+			referenced[artifactId] = true
+		}
+	}
+	for _, artifactId := range b.Inputs {
+		referenced[artifactId] = true
+	}
+
+	removed := 0
+	for artifactId := range g.Nodes {
+		if !referenced[artifactId] {
+			delete(g.Nodes, artifactId)
+			removed++
+		}
+	}
+	maps.DeleteFunc(b.ArtifactHandles, func(_ ArtifactHandle, id NodeId) bool {
+		return !referenced[id]
+	})
+	return removed
+}
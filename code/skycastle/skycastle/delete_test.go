@@ -0,0 +1,134 @@
+package skycastle
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDeleteAction_RemovesOutputsUnlessConsumed(t *testing.T) {
+	b := NewWorkflowGraphBuilder()
+	src := b.AddFileArtifact(WithArtifactPath("main.go"))
+
+	build := b.AddAction("go build")
+	if err := b.AddInput(build, Port("SRC"), src); err != nil {
+		t.Fatalf("AddInput: %v", err)
+	}
+	bin, err := b.AddOutputFile(build, Port("BIN"))
+	if err != nil {
+		t.Fatalf("AddOutputFile: %v", err)
+	}
+
+	test := b.AddAction("./test.sh")
+	if err := b.AddInput(test, Port("BIN"), bin); err != nil {
+		t.Fatalf("AddInput: %v", err)
+	}
+
+	if err := b.DeleteAction(build); !errors.Is(err, ErrStillReferenced) {
+		t.Fatalf("expected ErrStillReferenced while the binary is consumed, got %v", err)
+	}
+	if len(b.Cospan.Apex.Edges) != 2 || len(b.Cospan.Apex.Nodes) != 2 {
+		t.Fatalf("expected a failed delete to change nothing, got %d actions and %d artifacts",
+			len(b.Cospan.Apex.Edges), len(b.Cospan.Apex.Nodes))
+	}
+
+	if err := b.DeleteAction(test); err != nil {
+		t.Fatalf("DeleteAction(test): %v", err)
+	}
+	if err := b.DeleteAction(build); err != nil {
+		t.Fatalf("DeleteAction(build): %v", err)
+	}
+
+	if len(b.Cospan.Apex.Edges) != 0 {
+		t.Fatalf("expected no actions, got %d", len(b.Cospan.Apex.Edges))
+	}
+	if len(b.Cospan.Apex.Nodes) != 1 {
+		t.Fatalf("expected only the source to remain, got %d artifacts", len(b.Cospan.Apex.Nodes))
+	}
+	if _, ok := b.ArtifactHandles[bin]; ok {
+		t.Fatalf("expected the binary's handle to be removed")
+	}
+	if _, ok := b.ActionHandles[build]; ok {
+		t.Fatalf("expected the action's handle to be removed")
+	}
+	if err := b.DeleteAction(build); !errors.Is(err, ErrInvalidActionHandle) {
+		t.Fatalf("expected ErrInvalidActionHandle for a deleted action, got %v", err)
+	}
+}
+
+func TestDeleteArtifact_RefusesDanglingReferences(t *testing.T) {
+	b := NewWorkflowGraphBuilder()
+	src := b.AddFileArtifact(WithArtifactPath("main.go"))
+	makefile := b.AddFileArtifact(WithArtifactPath("Makefile"))
+	exposed := b.AddFileArtifact(WithArtifactPath("README.md"))
+
+	act := b.AddAction("make")
+	if err := b.AddInput(act, Port("SRC"), src); err != nil {
+		t.Fatalf("AddInput: %v", err)
+	}
+	if err := b.AddDep(act, makefile); err != nil {
+		t.Fatalf("AddDep: %v", err)
+	}
+	if _, err := b.ExposeRight(exposed); err != nil {
+		t.Fatalf("ExposeRight: %v", err)
+	}
+
+	for name, artifact := range map[string]ArtifactHandle{"input": src, "dep": makefile, "boundary": exposed} {
+		if err := b.DeleteArtifact(artifact); !errors.Is(err, ErrStillReferenced) {
+			t.Fatalf("expected ErrStillReferenced deleting the %s, got %v", name, err)
+		}
+	}
+
+	if err := b.DeleteAction(act); err != nil {
+		t.Fatalf("DeleteAction: %v", err)
+	}
+	if err := b.DeleteArtifact(src); err != nil {
+		t.Fatalf("DeleteArtifact: %v", err)
+	}
+	if _, ok := b.ArtifactHandles[src]; ok || len(b.Cospan.Apex.Nodes) != 2 {
+		t.Fatalf("expected the source artifact to be removed, %d artifacts remain", len(b.Cospan.Apex.Nodes))
+	}
+}
+
+func TestGC_RemovesOnlyOrphans(t *testing.T) {
+	b := NewWorkflowGraphBuilder()
+	src := b.AddFileArtifact(WithArtifactPath("main.go"))
+	input := b.AddFileArtifact(WithArtifactPath("input"))
+	exposed := b.AddFileArtifact(WithArtifactPath("exposed"))
+	orphan := b.AddFileArtifact(WithArtifactPath("orphan"))
+	b.Inputs[Port("IN")] = b.ArtifactHandles[input]
+	if _, err := b.ExposeRight(exposed); err != nil {
+		t.Fatalf("ExposeRight: %v", err)
+	}
+
+	build := b.AddAction("go build")
+	if err := b.AddInput(build, Port("SRC"), src); err != nil {
+		t.Fatalf("AddInput: %v", err)
+	}
+	if _, err := b.AddOutputFile(build, Port("BIN")); err != nil {
+		t.Fatalf("AddOutputFile: %v", err)
+	}
+
+	if removed := b.GC(); removed != 1 {
+		t.Fatalf("expected only the orphan to be removed, removed %d", removed)
+	}
+	if _, ok := b.ArtifactHandles[orphan]; ok {
+		t.Fatalf("expected the orphan's handle to be removed")
+	}
+	if len(b.Cospan.Apex.Nodes) != 4 {
+		t.Fatalf("expected 4 artifacts to remain, got %d", len(b.Cospan.Apex.Nodes))
+	}
+
+	// Deleting the action orphans its source, which the next GC removes.
+	if err := b.DeleteAction(build); err != nil {
+		t.Fatalf("DeleteAction: %v", err)
+	}
+	if removed := b.GC(); removed != 1 {
+		t.Fatalf("expected the source to be removed, removed %d", removed)
+	}
+	if _, ok := b.ArtifactHandles[src]; ok {
+		t.Fatalf("expected the source's handle to be removed")
+	}
+	if removed := b.GC(); removed != 0 {
+		t.Fatalf("expected nothing left to collect, removed %d", removed)
+	}
+}
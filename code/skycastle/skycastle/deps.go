@@ -0,0 +1,144 @@
+package skycastle
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"strings"
+)
+
+var (
+	ErrUnknownAction   = errors.New("unknown action")
+	ErrUnknownArtifact = errors.New("unknown artifact")
+)
+
+// DepSet is the result of a dependency query: the actions and artifacts it
+// reached, each ordered by id.
+type DepSet struct {
+	Actions   []EdgeId
+	Artifacts []NodeId
+}
+
+// Deps returns everything an action transitively depends on: the artifacts it
+// consumes as inputs or deps, the actions producing them, what those actions
+// consume, and so on. The action itself is not included. A depth of n stops
+// after n steps from an artifact to its producer, so a depth of 1 yields the
+// action's own inputs and deps and their producers; a depth of zero or less
+// follows the graph to its sources. Each action is visited once, so a graph
+// with a cycle still terminates.
+func (g *WorkflowGraph) Deps(action EdgeId, depth int) (DepSet, error) {
+	if _, ok := g.Edges[action]; !ok {
+		return DepSet{}, ErrUnknownAction
+	}
+
+	producers := g.producerIndex()
+	actions := map[EdgeId]bool{action: true}
+	artifacts := make(map[NodeId]bool)
+
+	frontier := []EdgeId{action}
+	for step := 0; len(frontier) > 0 && (depth <= 0 || step < depth); step++ {
+		var next []EdgeId
+		for _, id := range frontier {
+			for _, artifact := range g.dependencies(id) {
+				artifacts[artifact] = true
+				producer, ok := producers[artifact]
+				if ok && !actions[producer] {
+					actions[producer] = true
+					next = append(next, producer)
+				}
+			}
+		}
+		frontier = next
+	}
+
+	delete(actions, action)
+	return newDepSet(actions, artifacts), nil
+}
+
+// RDeps returns everything that must re-run if an artifact changes: the
+// actions consuming it as an input or dep, the artifacts they produce, the
+// actions consuming those, and so on. The artifact itself is not included. A
+// depth of n stops after n steps from an artifact to its consumers; a depth of
+// zero or less follows the graph to its sinks. Each action is visited once,
+// so a graph with a cycle still terminates.
+func (g *WorkflowGraph) RDeps(artifact NodeId, depth int) (DepSet, error) {
+	if _, ok := g.Nodes[artifact]; !ok {
+		return DepSet{}, ErrUnknownArtifact
+	}
+
+	actions, artifacts := g.reverseClosure([]NodeId{artifact}, depth)
+	delete(artifacts, artifact)
+	return newDepSet(actions, artifacts), nil
+}
+
+// ActionRDeps returns everything that must re-run if an action changes: the
+// reverse dependencies, as RDeps finds them, of all of its outputs. Neither
+// the action nor its outputs are included.
+func (g *WorkflowGraph) ActionRDeps(action EdgeId, depth int) (DepSet, error) {
+	edge, ok := g.Edges[action]
+	if !ok {
+		return DepSet{}, ErrUnknownAction
+	}
+
+	outputs := make([]NodeId, 0, len(edge.Outputs))
+	for _, port := range slices.Sorted(maps.Keys(edge.Outputs)) {
+		outputs = append(outputs, edge.Outputs[port])
+	}
+
+	actions, artifacts := g.reverseClosure(outputs, depth)
+	delete(actions, action)
+	for _, output := range outputs {
+		delete(artifacts, output)
+	}
+	return newDepSet(actions, artifacts), nil
+}
+
+// reverseClosure follows consumer edges breadth first from the given
+// artifacts for up to depth steps, or without limit if depth is zero or less.
+func (g *WorkflowGraph) reverseClosure(start []NodeId, depth int) (map[EdgeId]bool, map[NodeId]bool) {
+	consumers := make(map[NodeId][]EdgeId)
+	for _, id := range sortedEdgeIds(g) {
+		for _, artifact := range g.dependencies(id) {
+			consumers[artifact] = append(consumers[artifact], id)
+		}
+	}
+
+	actions := make(map[EdgeId]bool)
+	artifacts := make(map[NodeId]bool)
+	for _, artifact := range start {
+		artifacts[artifact] = true
+	}
+
+	frontier := start
+	for step := 0; len(frontier) > 0 && (depth <= 0 || step < depth); step++ {
+		var next []NodeId
+		for _, artifact := range frontier {
+			for _, consumer := range consumers[artifact] {
+				if actions[consumer] {
+					continue
+				}
+				actions[consumer] = true
+				for _, port := range slices.Sorted(maps.Keys(g.Edges[consumer].Outputs)) {
+					output := g.Edges[consumer].Outputs[port]
+					if !artifacts[output] {
+						artifacts[output] = true
+						next = append(next, output)
+					}
+				}
+			}
+		}
+		frontier = next
+	}
+	return actions, artifacts
+}
+
+func newDepSet(actions map[EdgeId]bool, artifacts map[NodeId]bool) DepSet {
+	return DepSet{
+		Actions: slices.SortedFunc(maps.Keys(actions), func(a, b EdgeId) int {
+			return strings.Compare(Unique(a).String(), Unique(b).String())
+		}),
+		Artifacts: slices.SortedFunc(maps.Keys(artifacts), func(a, b NodeId) int {
+			return strings.Compare(Unique(a).String(), Unique(b).String())
+		}),
+	}
+}
@@ -0,0 +1,157 @@
+package skycastle
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// depsTestGraph wires gen -> x -> compile -> y -> link -> z, with compile
+// also depending on lib from fetch, and an unrelated action on the side.
+func depsTestGraph(t *testing.T) (*WorkflowGraphBuilder, map[string]ActionHandle, map[string]ArtifactHandle) {
+	t.Helper()
+	b := NewWorkflowGraphBuilder()
+	actions := map[string]ActionHandle{}
+	artifacts := map[string]ArtifactHandle{}
+
+	for _, name := range []string{"gen", "fetch", "compile", "link", "unrelated"} {
+		actions[name] = b.AddAction(name)
+	}
+	for action, out := range map[string]string{"gen": "x", "fetch": "lib", "compile": "y", "link": "z", "unrelated": "u"} {
+		artifact, err := b.AddOutputFile(actions[action], Port("OUT"))
+		if err != nil {
+			t.Fatalf("AddOutputFile: %v", err)
+		}
+		artifacts[out] = artifact
+	}
+	for _, err := range []error{
+		b.AddInput(actions["compile"], Port("IN"), artifacts["x"]),
+		b.AddDep(actions["compile"], artifacts["lib"]),
+		b.AddInput(actions["link"], Port("IN"), artifacts["y"]),
+	} {
+		if err != nil {
+			t.Fatalf("wiring: %v", err)
+		}
+	}
+	return b, actions, artifacts
+}
+
+func expectDepSet(t *testing.T, b *WorkflowGraphBuilder, got DepSet, actions []ActionHandle, artifacts []ArtifactHandle) {
+	t.Helper()
+	wantActions := map[EdgeId]bool{}
+	for _, h := range actions {
+		wantActions[b.ActionHandles[h]] = true
+	}
+	wantArtifacts := map[NodeId]bool{}
+	for _, h := range artifacts {
+		wantArtifacts[b.ArtifactHandles[h]] = true
+	}
+	if want := newDepSet(wantActions, wantArtifacts); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestDeps_TransitiveAndDepthLimited(t *testing.T) {
+	b, actions, artifacts := depsTestGraph(t)
+	g := b.Cospan.Apex
+	link := b.ActionHandles[actions["link"]]
+
+	all, err := g.Deps(link, 0)
+	if err != nil {
+		t.Fatalf("Deps: %v", err)
+	}
+	expectDepSet(t, b, all,
+		[]ActionHandle{actions["compile"], actions["gen"], actions["fetch"]},
+		[]ArtifactHandle{artifacts["y"], artifacts["x"], artifacts["lib"]})
+
+	direct, err := g.Deps(link, 1)
+	if err != nil {
+		t.Fatalf("Deps: %v", err)
+	}
+	expectDepSet(t, b, direct, []ActionHandle{actions["compile"]}, []ArtifactHandle{artifacts["y"]})
+
+	source, err := g.Deps(b.ActionHandles[actions["gen"]], 0)
+	if err != nil {
+		t.Fatalf("Deps: %v", err)
+	}
+	expectDepSet(t, b, source, nil, nil)
+
+	if _, err := g.Deps(NewEdgeId(), 0); !errors.Is(err, ErrUnknownAction) {
+		t.Fatalf("expected ErrUnknownAction, got %v", err)
+	}
+}
+
+func TestDeps_TerminatesOnCycle(t *testing.T) {
+	b, actions, artifacts := depsTestGraph(t)
+	g := b.Cospan.Apex
+
+	// Feed link's output back into gen, bypassing the builder's cycle checks.
+	gen := b.ActionHandles[actions["gen"]]
+	g.Edges[gen].Inputs[Port("BACK")] = b.ArtifactHandles[artifacts["z"]]
+
+	got, err := g.Deps(b.ActionHandles[actions["link"]], 0)
+	if err != nil {
+		t.Fatalf("Deps: %v", err)
+	}
+	expectDepSet(t, b, got,
+		[]ActionHandle{actions["compile"], actions["gen"], actions["fetch"]},
+		[]ArtifactHandle{artifacts["y"], artifacts["x"], artifacts["lib"], artifacts["z"]})
+}
+
+func TestRDeps_TransitiveAndDepthLimited(t *testing.T) {
+	b, actions, artifacts := depsTestGraph(t)
+	g := b.Cospan.Apex
+	x := b.ArtifactHandles[artifacts["x"]]
+
+	all, err := g.RDeps(x, 0)
+	if err != nil {
+		t.Fatalf("RDeps: %v", err)
+	}
+	expectDepSet(t, b, all,
+		[]ActionHandle{actions["compile"], actions["link"]},
+		[]ArtifactHandle{artifacts["y"], artifacts["z"]})
+
+	direct, err := g.RDeps(x, 1)
+	if err != nil {
+		t.Fatalf("RDeps: %v", err)
+	}
+	expectDepSet(t, b, direct, []ActionHandle{actions["compile"]}, []ArtifactHandle{artifacts["y"]})
+
+	// A dep is followed like an input.
+	fetch, err := g.ActionRDeps(b.ActionHandles[actions["fetch"]], 0)
+	if err != nil {
+		t.Fatalf("ActionRDeps: %v", err)
+	}
+	expectDepSet(t, b, fetch,
+		[]ActionHandle{actions["compile"], actions["link"]},
+		[]ArtifactHandle{artifacts["y"], artifacts["z"]})
+
+	sink, err := g.RDeps(b.ArtifactHandles[artifacts["z"]], 0)
+	if err != nil {
+		t.Fatalf("RDeps: %v", err)
+	}
+	expectDepSet(t, b, sink, nil, nil)
+
+	if _, err := g.RDeps(NewNodeId(), 0); !errors.Is(err, ErrUnknownArtifact) {
+		t.Fatalf("expected ErrUnknownArtifact, got %v", err)
+	}
+	if _, err := g.ActionRDeps(NewEdgeId(), 0); !errors.Is(err, ErrUnknownAction) {
+		t.Fatalf("expected ErrUnknownAction, got %v", err)
+	}
+}
+
+func TestRDeps_TerminatesOnCycle(t *testing.T) {
+	b, actions, artifacts := depsTestGraph(t)
+	g := b.Cospan.Apex
+
+	gen := b.ActionHandles[actions["gen"]]
+	g.Edges[gen].Inputs[Port("BACK")] = b.ArtifactHandles[artifacts["z"]]
+
+	got, err := g.ActionRDeps(gen, 0)
+	if err != nil {
+		t.Fatalf("ActionRDeps: %v", err)
+	}
+	expectDepSet(t, b, got,
+		[]ActionHandle{actions["compile"], actions["link"]},
+		[]ArtifactHandle{artifacts["y"], artifacts["z"]})
+}
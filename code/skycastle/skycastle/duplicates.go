@@ -0,0 +1,173 @@
+package skycastle
+
+import (
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
+)
+
+// actionIdentity returns a key equal for two actions exactly when they would
+// do the same work. Beyond description, command and inputs it covers policy,
+// caching, working directory, environment, deps and the kind, path and format
+// of each output, since actions differing in any of these cannot stand in for
+// each other.
+func (g *WorkflowGraph) actionIdentity(id EdgeId) string {
+	edge := g.Edges[id]
+
+	t := tuple.Tuple{
+		edge.Description,
+		edge.Command,
+		int64(edge.Policy.MaxDurationSeconds),
+		int64(edge.Policy.MaxRetries),
+		edge.NoCache,
+		edge.WorkingDir,
+	}
+
+	env := tuple.Tuple{}
+	for _, name := range slices.Sorted(maps.Keys(edge.Env)) {
+		env = append(env, name, edge.Env[name])
+	}
+
+	inputs := tuple.Tuple{}
+	for _, port := range slices.Sorted(maps.Keys(edge.Inputs)) {
+		id := edge.Inputs[port]
+		inputs = append(inputs, string(port), id[:])
+	}
+
+	order := tuple.Tuple{}
+	for _, port := range edge.InputOrder {
+		order = append(order, string(port))
+	}
+
+	depIds := slices.Clone(edge.Deps)
+	slices.SortFunc(depIds, func(a, b NodeId) int {
+		return slices.Compare(a[:], b[:])
+	})
+	depIds = slices.Compact(depIds)
+	deps := tuple.Tuple{}
+	for _, id := range depIds {
+		deps = append(deps, id[:])
+	}
+
+	outputs := tuple.Tuple{}
+	for _, port := range slices.Sorted(maps.Keys(edge.Outputs)) {
+		node := g.Nodes[edge.Outputs[port]]
+		outputs = append(outputs, string(port), int64(node.Kind), node.Path, node.Format, node.kindMetadata())
+	}
+
+	return string(append(t, env, inputs, order, deps, outputs).Pack())
+}
+
+// FindDuplicates groups actions that would do the same work. Each group has
+// at least two members, sorted by id, and groups are sorted by their first
+// member.
+func (g *WorkflowGraph) FindDuplicates() [][]EdgeId {
+	byIdentity := make(map[string][]EdgeId)
+	for _, id := range sortedEdgeIds(g) {
+		key := g.actionIdentity(id)
+		byIdentity[key] = append(byIdentity[key], id)
+	}
+
+	groups := [][]EdgeId{}
+	for _, group := range byIdentity {
+		if len(group) > 1 {
+			groups = append(groups, group)
+		}
+	}
+
+	slices.SortFunc(groups, func(a, b []EdgeId) int {
+		return strings.Compare(Unique(a[0]).String(), Unique(b[0]).String())
+	})
+	return groups
+}
+
+// MergeDuplicates merges each group of duplicate actions into its first
+// member. Consumers of a duplicate's outputs are rewired to the
+// representative's output on the same port, and the duplicate and its outputs
+// are removed. Handles to removed actions and artifacts follow the merge.
+// Merging can make downstream actions identical, so it repeats until no
+// duplicates remain, and returns the number of actions removed.
+func (b *WorkflowGraphBuilder) MergeDuplicates() int {
+	g := b.Cospan.Apex
+	removed := 0
+	b.index = nil
+
+	for {
+		groups := g.FindDuplicates()
+		if len(groups) == 0 {
+			return removed
+		}
+
+		actionRemap := make(map[EdgeId]EdgeId)
+		artifactRemap := make(map[NodeId]NodeId)
+
+		for _, group := range groups {
+			representative := g.Edges[group[0]]
+			for _, duplicateId := range group[1:] {
+				for port, output := range g.Edges[duplicateId].Outputs {
+					artifactRemap[output] = representative.Outputs[port]
+					delete(g.Nodes, output)
+				}
+				delete(g.Edges, duplicateId)
+				actionRemap[duplicateId] = group[0]
+				removed++
+			}
+		}
+
+		remapNode := func(id NodeId) NodeId {
+			if to, ok := artifactRemap[id]; ok {
+				return to
+			}
+			return id
+		}
+
+		for id, edge := range g.Edges {
+			for port, artifactId := range edge.Inputs {
+				edge.Inputs[port] = remapNode(artifactId)
+			}
+			deps := edge.Deps[:0]
+			for _, artifactId := range edge.Deps {
+				if artifactId = remapNode(artifactId); !slices.Contains(deps, artifactId) {
+					deps = append(deps, artifactId)
+				}
+			}
+			edge.Deps = deps
+			g.Edges[id] = edge
+		}
+
+		for handle, id := range b.ArtifactHandles {
+			b.ArtifactHandles[handle] = remapNode(id)
+		}
+		for handle, id := range b.ActionHandles {
+			if to, ok := actionRemap[id]; ok {
+				b.ActionHandles[handle] = to
+			}
+		}
+		for port, id := range b.Inputs {
+			b.Inputs[port] = remapNode(id)
+		}
+		for handle, id := range b.Cospan.Left {
+			b.Cospan.Left[handle] = remapNode(id)
+		}
+		for handle, id := range b.Cospan.Right {
+			b.Cospan.Right[handle] = remapNode(id)
+		}
+	}
+}
+
+// DuplicateActions groups the workflow's actions that would do the same
+// work, as found by WorkflowGraph.FindDuplicates.
+func (wr *WorkflowSpec) DuplicateActions() [][]Action {
+	duplicates := wr.graph.FindDuplicates()
+	groups := make([][]Action, 0, len(duplicates))
+	for _, ids := range duplicates {
+		group := make([]Action, len(ids))
+		for i, id := range ids {
+			group[i] = ActionCursor{ws: wr, id: id}
+		}
+		groups = append(groups, group)
+	}
+	return groups
+}
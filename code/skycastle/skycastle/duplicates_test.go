@@ -0,0 +1,137 @@
+package skycastle
+
+import (
+	"testing"
+)
+
+func TestFindDuplicates_GroupsIdenticalActions(t *testing.T) {
+	b := NewWorkflowGraphBuilder()
+	src := b.AddFileArtifact(WithArtifactPath("main.go"))
+
+	var builds []ActionHandle
+	for range 2 {
+		act := b.AddAction("go build", WithActionDescription("build"))
+		if err := b.AddInput(act, Port("SRC"), src); err != nil {
+			t.Fatalf("AddInput: %v", err)
+		}
+		if _, err := b.AddOutputFile(act, Port("BIN")); err != nil {
+			t.Fatalf("AddOutputFile: %v", err)
+		}
+		builds = append(builds, act)
+	}
+
+	// Same label and command, but a different environment: not a duplicate.
+	cross := b.AddAction("go build", WithActionDescription("build"), WithEnvVar("GOOS", "darwin"))
+	if err := b.AddInput(cross, Port("SRC"), src); err != nil {
+		t.Fatalf("AddInput: %v", err)
+	}
+	if _, err := b.AddOutputFile(cross, Port("BIN")); err != nil {
+		t.Fatalf("AddOutputFile: %v", err)
+	}
+
+	groups := b.Cospan.Apex.FindDuplicates()
+	if len(groups) != 1 {
+		t.Fatalf("expected 1 duplicate group, got %d: %v", len(groups), groups)
+	}
+	if len(groups[0]) != 2 {
+		t.Fatalf("expected 2 actions in the group, got %d", len(groups[0]))
+	}
+	for _, act := range builds {
+		id := b.ActionHandles[act]
+		if groups[0][0] != id && groups[0][1] != id {
+			t.Fatalf("expected action %v in the duplicate group %v", Unique(id).Short(), groups[0])
+		}
+	}
+}
+
+func TestFindDuplicates_SeparatesOutputPaths(t *testing.T) {
+	b := NewWorkflowGraphBuilder()
+	src := b.AddFileArtifact(WithArtifactPath("main.go"))
+
+	// Identical but for where, or in what format, the output is written.
+	for _, opts := range [][]ArtifactOption{
+		{WithArtifactPath("out/a")},
+		{WithArtifactPath("out/b")},
+		{WithArtifactPath("out/a"), WithArtifactFormat("tar")},
+	} {
+		act := b.AddAction("go build")
+		if err := b.AddInput(act, Port("SRC"), src); err != nil {
+			t.Fatalf("AddInput: %v", err)
+		}
+		if _, err := b.AddOutputFile(act, Port("BIN"), opts...); err != nil {
+			t.Fatalf("AddOutputFile: %v", err)
+		}
+	}
+
+	if groups := b.Cospan.Apex.FindDuplicates(); len(groups) != 0 {
+		t.Fatalf("expected actions with different outputs not to be grouped, got %v", groups)
+	}
+	if removed := b.MergeDuplicates(); removed != 0 {
+		t.Fatalf("expected nothing to be merged, got %d", removed)
+	}
+}
+
+func TestMergeDuplicates_RewiresConsumers(t *testing.T) {
+	b := NewWorkflowGraphBuilder()
+	src := b.AddFileArtifact(WithArtifactPath("main.go"))
+
+	var bins []ArtifactHandle
+	var builds, tests []ActionHandle
+	for range 2 {
+		build := b.AddAction("go build")
+		if err := b.AddInput(build, Port("SRC"), src); err != nil {
+			t.Fatalf("AddInput: %v", err)
+		}
+		bin, err := b.AddOutputFile(build, Port("BIN"))
+		if err != nil {
+			t.Fatalf("AddOutputFile: %v", err)
+		}
+
+		// The consumers only become identical once the builds are merged.
+		test := b.AddAction("./test.sh")
+		if err := b.AddInput(test, Port("BIN"), bin); err != nil {
+			t.Fatalf("AddInput: %v", err)
+		}
+		if _, err := b.AddOutputFile(test, Port("REPORT")); err != nil {
+			t.Fatalf("AddOutputFile: %v", err)
+		}
+
+		bins = append(bins, bin)
+		builds = append(builds, build)
+		tests = append(tests, test)
+	}
+
+	if removed := b.MergeDuplicates(); removed != 2 {
+		t.Fatalf("expected 2 actions removed, got %d", removed)
+	}
+
+	g := b.Cospan.Apex
+	if len(g.Edges) != 2 {
+		t.Fatalf("expected 2 actions after merge, got %d", len(g.Edges))
+	}
+	if len(g.Nodes) != 3 {
+		t.Fatalf("expected 3 artifacts after merge, got %d", len(g.Nodes))
+	}
+
+	if b.ActionHandles[builds[0]] != b.ActionHandles[builds[1]] {
+		t.Fatalf("expected both build handles to resolve to one action")
+	}
+	if b.ActionHandles[tests[0]] != b.ActionHandles[tests[1]] {
+		t.Fatalf("expected both test handles to resolve to one action")
+	}
+	if b.ArtifactHandles[bins[0]] != b.ArtifactHandles[bins[1]] {
+		t.Fatalf("expected both binary handles to resolve to one artifact")
+	}
+
+	test := g.Edges[b.ActionHandles[tests[0]]]
+	if test.Inputs[Port("BIN")] != b.ArtifactHandles[bins[0]] {
+		t.Fatalf("expected the surviving test to consume the surviving binary")
+	}
+	if _, ok := g.Nodes[test.Inputs[Port("BIN")]]; !ok {
+		t.Fatalf("surviving test consumes a removed artifact")
+	}
+
+	if groups := g.FindDuplicates(); len(groups) != 0 {
+		t.Fatalf("expected no duplicates after merge, got %v", groups)
+	}
+}
@@ -6,10 +6,12 @@ import (
 	"fmt"
 	"iter"
 	"log/slog"
+	"maps"
 	"os"
 	"path/filepath"
 	"skycastle/skycastle/parser"
 	"slices"
+	"strings"
 	"sync"
 	"time"
 
@@ -83,6 +85,12 @@ type ExecutionOptions struct {
 	FileOptions      *syntax.FileOptions
 	Timeout          time.Duration
 	ConcurrencyLimit int
+	Progress         ProgressFunc
+	Strict           bool
+
+	// Sources holds package sources that are read from here instead of
+	// from the repository, such as a workflow piped in on stdin.
+	Sources map[Path[Relative, File]][]byte
 }
 
 type ExecutionOption func(*ExecutionOptions)
@@ -105,6 +113,36 @@ func WithConcurrencyLimit(limit int) ExecutionOption {
 	}
 }
 
+// StdinPackagePath is the synthetic package path for a workflow read from
+// stdin. It is not a valid repository path, so it never collides with a
+// real package.
+var StdinPackagePath = Path[Relative, File]{path: "<stdin>"}
+
+// WithSource provides the source of a package directly instead of reading
+// it from the repository.
+func WithSource(packagePath Path[Relative, File], src []byte) ExecutionOption {
+	return func(opts *ExecutionOptions) {
+		if opts.Sources == nil {
+			opts.Sources = make(map[Path[Relative, File]][]byte)
+		}
+		opts.Sources[packagePath] = src
+	}
+}
+
+func WithProgress(progress ProgressFunc) ExecutionOption {
+	return func(opts *ExecutionOptions) {
+		opts.Progress = progress
+	}
+}
+
+// WithStrict enables strict evaluation: references to undefined names are
+// reported with their position and a suggested builtin.
+func WithStrict(strict bool) ExecutionOption {
+	return func(opts *ExecutionOptions) {
+		opts.Strict = strict
+	}
+}
+
 func AllowSetFunction(set bool) ExecutionOption {
 	return func(opts *ExecutionOptions) {
 		opts.FileOptions.Set = set
@@ -166,18 +204,27 @@ func DefaultConcurrencyLimit() int {
 	return 4
 }
 
+// readPackageSource returns the source of a package, preferring a source
+// provided in the execution options over the repository.
+func readPackageSource(executionOptions ExecutionOptions, packagePath Path[Relative, File]) ([]byte, error) {
+	if src, ok := executionOptions.Sources[packagePath]; ok {
+		return src, nil
+	}
+	return os.ReadFile(Join(executionOptions.RepoRoot, packagePath).String())
+}
+
 func ParseImports(executionOptions ExecutionOptions, packagePath Path[Relative, File]) ([]Path[Relative, File], error) {
 	slog.Debug("Parsing imports for package", "packagePath", packagePath.String())
 
 	absolutePackagePath := Join(executionOptions.RepoRoot, packagePath)
-	file, err := executionOptions.FileOptions.Parse(absolutePackagePath.String(), nil, 0)
+	src, err := readPackageSource(executionOptions, packagePath)
 	if err != nil {
-		var syntaxError syntax.Error
-		src, readErr := os.ReadFile(absolutePackagePath.String())
-		if readErr != nil {
-			return nil, readErr
-		}
+		return nil, err
+	}
 
+	file, err := executionOptions.FileOptions.Parse(absolutePackagePath.String(), src, 0)
+	if err != nil {
+		var syntaxError syntax.Error
 		if errors.As(err, &syntaxError) {
 			state := parser.State{
 				Input:  src,
@@ -306,15 +353,31 @@ type ExecutionResult struct {
 	Err     error
 }
 
-func builtins(pkg *Package) starlark.StringDict {
+// Targets returns the targets defined by the package, by workflow() or
+// target(), in a stable order.
+func (p *Package) Targets() []Target {
+	targets := slices.AppendSeq(make([]Target, 0, len(p.Workflows)), maps.Keys(p.Workflows))
+	slices.SortFunc(targets, func(a, b Target) int {
+		return strings.Compare(a.String(), b.String())
+	})
+	return targets
+}
+
+func builtins(pkg *Package, repoRoot Path[Absolute, Directory]) starlark.StringDict {
 	builtins := starlark.StringDict{
-		"action": starlark.NewBuiltin("action", ActionBuiltin()),
-		"file":   starlark.NewBuiltin("file", FileBuiltin()),
-		"dir":    starlark.NewBuiltin("dir", DirBuiltin()),
-		"policy": starlark.NewBuiltin("policy", PolicyBuiltin()),
+		"action":  starlark.NewBuiltin("action", ActionBuiltin()),
+		"file":    starlark.NewBuiltin("file", FileBuiltin(repoRoot)),
+		"dir":     starlark.NewBuiltin("dir", DirBuiltin(repoRoot)),
+		"symlink": starlark.NewBuiltin("symlink", SymlinkBuiltin(repoRoot)),
+		"archive": starlark.NewBuiltin("archive", ArchiveBuiltin(repoRoot)),
+		"image":   starlark.NewBuiltin("image", ImageBuiltin(repoRoot)),
+		"policy":  starlark.NewBuiltin("policy", PolicyBuiltin()),
 		"workflow": starlark.NewBuiltin("workflow", WorkflowBuiltin(pkg.Path, func(wf Workflow) {
 			pkg.Workflows[wf.Target()] = wf
 		})),
+		"target": starlark.NewBuiltin("target", TargetBuiltin(pkg.Path, func(wf Workflow) {
+			pkg.Workflows[wf.Target()] = wf
+		})),
 	}
 
 	return builtins
@@ -379,6 +442,14 @@ func executeGraph(
 		})
 	}
 
+	// Stop the workers on every return path, including cancellation, so no
+	// package evaluation outlives the call.
+	defer func() {
+		cancel()
+		close(jobs)
+		wg.Wait()
+	}()
+
 	for _, path := range nodes {
 		if indegrees[path] == 0 {
 			jobs <- path
@@ -393,6 +464,9 @@ func executeGraph(
 
 		case res := <-results:
 			if res.Err != nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
 				return nil, res.Err
 			}
 
@@ -408,9 +482,6 @@ func executeGraph(
 		}
 	}
 
-	close(jobs)
-	wg.Wait()
-
 	return packages, nil
 }
 
@@ -429,7 +500,7 @@ func worker(
 		taskCtx, cancelTask := context.WithTimeout(ctx, executionOptions.Timeout)
 
 		absolutePackagePath := Join(executionOptions.RepoRoot, packagePath)
-		src, err := os.ReadFile(absolutePackagePath.String())
+		src, err := readPackageSource(executionOptions, packagePath)
 		if err != nil {
 			results <- ExecutionResult{Err: fmt.Errorf("failed to read package source %s: %w", packagePath, err)}
 			cancelTask()
@@ -437,6 +508,7 @@ func worker(
 		}
 
 		pkg := NewPackage(packagePath)
+		pkg.Builder.Progress = executionOptions.Progress
 
 		thread := &starlark.Thread{
 			Name: absolutePackagePath.String(),
@@ -462,10 +534,14 @@ func worker(
 			}
 		}()
 
-		globals, err := starlark.ExecFileOptions(&syntax.FileOptions{}, thread, absolutePackagePath.String(), src, builtins(pkg))
+		predeclared := builtins(pkg, executionOptions.RepoRoot)
+		globals, err := starlark.ExecFileOptions(&syntax.FileOptions{}, thread, absolutePackagePath.String(), src, predeclared)
 
 		close(done)
 
+		if err != nil && executionOptions.Strict {
+			err = explainUndefinedNames(err, predeclared)
+		}
 		if err != nil {
 			results <- ExecutionResult{Err: fmt.Errorf("failed to execute package %s: %w", packagePath, err)}
 			cancelTask()
@@ -0,0 +1,140 @@
+package skycastle
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExecute_CancelledContextReturnsPromptly(t *testing.T) {
+	dir := t.TempDir()
+	src := "def spin():\n    for i in range(1000000000):\n        pass\n\nspin()\n"
+	if err := os.WriteFile(filepath.Join(dir, "spin.star"), []byte(src), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	repoRoot, err := ParseAbsoluteDirectory(dir)
+	if err != nil {
+		t.Fatalf("ParseAbsoluteDirectory: %v", err)
+	}
+	packagePath, err := ParseRelativeFile("spin.star")
+	if err != nil {
+		t.Fatalf("ParseRelativeFile: %v", err)
+	}
+
+	opts := ExecutionOptions{
+		RepoRoot:         repoRoot,
+		FileOptions:      DefaultFileOptions(),
+		Timeout:          DefaultTimeout(),
+		ConcurrencyLimit: 1,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err = Execute(ctx, opts, Target{Path: packagePath, Name: "t"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context deadline error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("expected cancelled execution to return promptly, took %s", elapsed)
+	}
+}
+
+func TestExecute_StrictSuggestsMisspelledBuiltin(t *testing.T) {
+	dir := t.TempDir()
+	src := "actoin(command = \"true\")\n"
+	if err := os.WriteFile(filepath.Join(dir, "typo.star"), []byte(src), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	repoRoot, err := ParseAbsoluteDirectory(dir)
+	if err != nil {
+		t.Fatalf("ParseAbsoluteDirectory: %v", err)
+	}
+	packagePath, err := ParseRelativeFile("typo.star")
+	if err != nil {
+		t.Fatalf("ParseRelativeFile: %v", err)
+	}
+
+	opts := ExecutionOptions{
+		RepoRoot:         repoRoot,
+		FileOptions:      DefaultFileOptions(),
+		Timeout:          DefaultTimeout(),
+		ConcurrencyLimit: 1,
+	}
+	WithStrict(true)(&opts)
+
+	_, err = Execute(context.Background(), opts, Target{Path: packagePath, Name: "t"})
+	if !errors.Is(err, ErrUndefinedName) {
+		t.Fatalf("expected ErrUndefinedName, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "typo.star:1:1: undefined: actoin (did you mean action?)") {
+		t.Fatalf("expected positioned suggestion in error, got %v", err)
+	}
+}
+
+func TestExecute_SourceFromStdin(t *testing.T) {
+	repoRoot, err := ParseAbsoluteDirectory(t.TempDir())
+	if err != nil {
+		t.Fatalf("ParseAbsoluteDirectory: %v", err)
+	}
+
+	src := "greet = action(command = \"echo hi\")\nworkflow(name = \"greet\", goals = [greet.stdout])\n"
+
+	opts := ExecutionOptions{
+		RepoRoot:         repoRoot,
+		FileOptions:      DefaultFileOptions(),
+		Timeout:          DefaultTimeout(),
+		ConcurrencyLimit: 1,
+	}
+	WithSource(StdinPackagePath, []byte(src))(&opts)
+
+	wf, err := Execute(context.Background(), opts, Target{Path: StdinPackagePath, Name: "greet"})
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+
+	var commands []string
+	for action := range wf.Actions() {
+		commands = append(commands, action.Command())
+	}
+	if len(commands) != 1 || commands[0] != "echo hi" {
+		t.Fatalf("expected a single \"echo hi\" action, got %v", commands)
+	}
+}
+
+func TestExecute_RejectsUnboundedControlFlow(t *testing.T) {
+	repoRoot, err := ParseAbsoluteDirectory(t.TempDir())
+	if err != nil {
+		t.Fatalf("ParseAbsoluteDirectory: %v", err)
+	}
+
+	// The default file options only govern parsing; packages are executed
+	// without while loops or top-level control flow, strict or not.
+	for name, tc := range map[string]struct{ src, want string }{
+		"while":         {"def f():\n    while True:\n        pass\n", "does not support while loops"},
+		"top_level_for": {"for x in [1]:\n    pass\n", "for loop not within a function"},
+		"top_level_if":  {"if True:\n    pass\n", "if statement not within a function"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			opts := ExecutionOptions{
+				RepoRoot:         repoRoot,
+				FileOptions:      DefaultFileOptions(),
+				Timeout:          DefaultTimeout(),
+				ConcurrencyLimit: 1,
+			}
+			WithSource(StdinPackagePath, []byte(tc.src))(&opts)
+
+			_, err := Execute(context.Background(), opts, Target{Path: StdinPackagePath, Name: "t"})
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("expected an error containing %q, got %v", tc.want, err)
+			}
+		})
+	}
+}
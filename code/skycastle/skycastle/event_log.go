@@ -3,22 +3,44 @@ package skycastle
 import (
 	"github.com/apple/foundationdb/bindings/go/src/fdb"
 	"github.com/apple/foundationdb/bindings/go/src/fdb/subspace"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
+	"github.com/google/uuid"
 )
 
+// RunId names one run of a workflow. Every run keeps its keys in its own
+// subspace, so concurrent and past runs coexist and starting a run never has
+// to clear anything.
+type RunId uuid.UUID
+
+func NewRunId() RunId {
+	return RunId(uuid.New())
+}
+
+func (r RunId) String() string {
+	return uuid.UUID(r).String()
+}
+
 type EventLog struct {
 	db        fdb.Database
+	run       RunId
 	root      subspace.Subspace
 	events    subspace.Subspace
 	snapshots subspace.Subspace
 }
 
-func NewEventLog(db fdb.Database) *EventLog {
-	root := subspace.Sub("skycastle")
+func NewEventLog(db fdb.Database, run RunId) *EventLog {
+	root := subspace.Sub("skycastle", "runs", tuple.UUID(run))
 
 	return &EventLog{
 		db:        db,
+		run:       run,
 		root:      root,
 		events:    root.Sub("events"),
 		snapshots: root.Sub("snapshots"),
 	}
 }
+
+// Run returns the run whose keys the log reads and writes.
+func (l *EventLog) Run() RunId {
+	return l.run
+}
@@ -1,6 +1,10 @@
 package skycastle
 
 import (
+	"errors"
+	"io/fs"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -63,6 +67,74 @@ type WorkflowInstance struct {
 	Goals       []*ArtifactInstance
 	Actions     map[ActionInstanceId]ActionInstance
 	Artifacts   map[ArtifactInstanceId]ArtifactInstance
+
+	// byDigest indexes ready artifacts by content digest. It is built from
+	// Artifacts on first use and kept up to date by SetArtifactReady.
+	byDigest map[Digest][]ArtifactInstanceId
+}
+
+var ErrUnknownArtifactInstance = errors.New("unknown artifact instance")
+
+// SetArtifactReady marks an artifact of the workflow as ready and indexes it
+// under its content digest.
+func (w *WorkflowInstance) SetArtifactReady(id ArtifactInstanceId, digest Digest, c cid.Cid, size int64) error {
+	artifact, ok := w.Artifacts[id]
+	if !ok {
+		return ErrUnknownArtifactInstance
+	}
+	w.indexDigests()
+
+	if old, ok := artifact.Digest(); ok {
+		w.byDigest[old] = slices.DeleteFunc(w.byDigest[old], func(other ArtifactInstanceId) bool {
+			return other == id
+		})
+		if len(w.byDigest[old]) == 0 {
+			delete(w.byDigest, old)
+		}
+	}
+
+	artifact.SetReady(digest, c, size)
+	w.Artifacts[id] = artifact
+	w.byDigest[digest] = append(w.byDigest[digest], id)
+	return nil
+}
+
+// ArtifactsWithDigest returns the ready artifacts of the workflow whose
+// content has the given digest, sorted by id.
+func (w *WorkflowInstance) ArtifactsWithDigest(digest Digest) []ArtifactInstanceId {
+	w.indexDigests()
+	ids := slices.Clone(w.byDigest[digest])
+	slices.SortFunc(ids, func(a, b ArtifactInstanceId) int {
+		return strings.Compare(uuid.UUID(a).String(), uuid.UUID(b).String())
+	})
+	if ids == nil {
+		ids = []ArtifactInstanceId{}
+	}
+	return ids
+}
+
+func (w *WorkflowInstance) indexDigests() {
+	if w.byDigest != nil {
+		return
+	}
+	w.byDigest = make(map[Digest][]ArtifactInstanceId)
+	for id, artifact := range w.Artifacts {
+		if digest, ok := artifact.Digest(); ok {
+			w.byDigest[digest] = append(w.byDigest[digest], id)
+		}
+	}
+}
+
+// TotalArtifactSize sums the sizes of all ready artifacts in the workflow.
+// Artifacts whose size is not known yet are skipped.
+func (w *WorkflowInstance) TotalArtifactSize() int64 {
+	var total int64
+	for _, artifact := range w.Artifacts {
+		if size, ok := artifact.Size(); ok {
+			total += size
+		}
+	}
+	return total
 }
 
 type isWorkflowInstance_Status interface {
@@ -103,6 +175,80 @@ func (a *ArtifactInstance) IsReady() bool {
 	return a.Status.IsReady()
 }
 
+// SetReady marks the artifact as ready with the given content digest, CID and
+// size in bytes.
+func (a *ArtifactInstance) SetReady(digest Digest, c cid.Cid, size int64) {
+	a.Status = &ArtifactInstance_Status_Ready{
+		Digest: digest,
+		Cid:    c,
+		Size:   size,
+	}
+}
+
+// Size returns the size in bytes of a ready artifact. The size of an artifact
+// that is not ready yet is unknown.
+func (a *ArtifactInstance) Size() (int64, bool) {
+	ready, ok := a.Status.(*ArtifactInstance_Status_Ready)
+	if !ok {
+		return 0, false
+	}
+	return ready.Size, true
+}
+
+// Digest returns the content digest of a ready artifact. The digest of an
+// artifact that is not ready yet is unknown.
+func (a *ArtifactInstance) Digest() (Digest, bool) {
+	ready, ok := a.Status.(*ArtifactInstance_Status_Ready)
+	if !ok {
+		return Digest{}, false
+	}
+	return ready.Digest, true
+}
+
+// FileMetadata is the filesystem metadata of a ready artifact as the
+// executor materialised it.
+type FileMetadata struct {
+	Size    int64
+	Mode    fs.FileMode
+	ModTime time.Time
+}
+
+// Executable reports whether any of the artifact's execute bits are set.
+func (m FileMetadata) Executable() bool {
+	return m.Mode&0o111 != 0
+}
+
+// Matches reports whether info describes a file with the same size, mode and
+// modification time, so a staged copy can be trusted without re-hashing it.
+func (m FileMetadata) Matches(info fs.FileInfo) bool {
+	return info.Size() == m.Size && info.Mode() == m.Mode && info.ModTime().Equal(m.ModTime)
+}
+
+var ErrArtifactNotReady = errors.New("artifact is not ready")
+
+// SetFileMetadata records the mode and modification time of a ready
+// artifact, next to the size given to SetReady. Calling SetReady again
+// clears them.
+func (a *ArtifactInstance) SetFileMetadata(mode fs.FileMode, modTime time.Time) error {
+	ready, ok := a.Status.(*ArtifactInstance_Status_Ready)
+	if !ok {
+		return ErrArtifactNotReady
+	}
+	ready.Mode = mode
+	ready.ModTime = modTime
+	return nil
+}
+
+// FileMetadata returns the filesystem metadata of a ready artifact. Mode and
+// ModTime are zero until SetFileMetadata is called.
+func (a *ArtifactInstance) FileMetadata() (FileMetadata, bool) {
+	ready, ok := a.Status.(*ArtifactInstance_Status_Ready)
+	if !ok {
+		return FileMetadata{}, false
+	}
+	return FileMetadata{Size: ready.Size, Mode: ready.Mode, ModTime: ready.ModTime}, true
+}
+
 type isArtifactInstance_Status interface {
 	isArtifactInstance_Status()
 	IsReady() bool
@@ -115,9 +261,11 @@ func (*ArtifactInstance_Status_Pending) isArtifactInstance_Status() {}
 func (*ArtifactInstance_Status_Pending) IsReady() bool { return false }
 
 type ArtifactInstance_Status_Ready struct {
-	Digest Digest
-	Cid    cid.Cid
-	Size   int64
+	Digest  Digest
+	Cid     cid.Cid
+	Size    int64
+	Mode    fs.FileMode
+	ModTime time.Time
 }
 
 func (*ArtifactInstance_Status_Ready) isArtifactInstance_Status() {}
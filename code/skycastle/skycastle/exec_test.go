@@ -0,0 +1,150 @@
+package skycastle
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ipfs/go-cid"
+)
+
+func TestArtifactInstance_SizeUnknownUntilReady(t *testing.T) {
+	a := &ArtifactInstance{Status: &ArtifactInstance_Status_Pending{}}
+
+	if _, ok := a.Size(); ok {
+		t.Fatalf("expected size of a pending artifact to be unknown")
+	}
+
+	a.SetReady(Digest{}, cid.Undef, 1024)
+
+	size, ok := a.Size()
+	if !ok {
+		t.Fatalf("expected size of a ready artifact to be known")
+	}
+	if size != 1024 {
+		t.Fatalf("expected size 1024, got %d", size)
+	}
+	if !a.IsReady() {
+		t.Fatalf("expected artifact to be ready")
+	}
+}
+
+func TestWorkflowInstance_TotalArtifactSize(t *testing.T) {
+	ready := func(size int64) ArtifactInstance {
+		a := ArtifactInstance{}
+		a.SetReady(Digest{}, cid.Undef, size)
+		return a
+	}
+
+	w := &WorkflowInstance{
+		Artifacts: map[ArtifactInstanceId]ArtifactInstance{
+			ArtifactInstanceId(uuid.New()): ready(100),
+			ArtifactInstanceId(uuid.New()): ready(23),
+			ArtifactInstanceId(uuid.New()): {Status: &ArtifactInstance_Status_Pending{}},
+		},
+	}
+
+	if got := w.TotalArtifactSize(); got != 123 {
+		t.Fatalf("expected total size 123, got %d", got)
+	}
+
+	if got := (&WorkflowInstance{}).TotalArtifactSize(); got != 0 {
+		t.Fatalf("expected empty workflow to have total size 0, got %d", got)
+	}
+}
+
+func TestWorkflowInstance_ArtifactsWithDigest(t *testing.T) {
+	preloaded, first, second := ArtifactInstanceId(uuid.New()), ArtifactInstanceId(uuid.New()), ArtifactInstanceId(uuid.New())
+	same, other := Digest{1}, Digest{2}
+
+	ready := ArtifactInstance{}
+	ready.SetReady(same, cid.Undef, 1)
+
+	w := &WorkflowInstance{
+		Artifacts: map[ArtifactInstanceId]ArtifactInstance{
+			preloaded: ready,
+			first:     {Status: &ArtifactInstance_Status_Pending{}},
+			second:    {Status: &ArtifactInstance_Status_Pending{}},
+		},
+	}
+
+	if err := w.SetArtifactReady(first, same, cid.Undef, 1); err != nil {
+		t.Fatalf("SetArtifactReady: %v", err)
+	}
+	if err := w.SetArtifactReady(second, other, cid.Undef, 2); err != nil {
+		t.Fatalf("SetArtifactReady: %v", err)
+	}
+
+	got := w.ArtifactsWithDigest(same)
+	if len(got) != 2 || !slices.Contains(got, preloaded) || !slices.Contains(got, first) {
+		t.Fatalf("expected the preloaded and first artifacts, got %v", got)
+	}
+
+	// Setting an artifact ready again moves it to its new digest.
+	if err := w.SetArtifactReady(first, other, cid.Undef, 2); err != nil {
+		t.Fatalf("SetArtifactReady: %v", err)
+	}
+	if got := w.ArtifactsWithDigest(same); !slices.Equal(got, []ArtifactInstanceId{preloaded}) {
+		t.Fatalf("expected only the preloaded artifact, got %v", got)
+	}
+	if got := w.ArtifactsWithDigest(other); len(got) != 2 {
+		t.Fatalf("expected two artifacts with the other digest, got %v", got)
+	}
+	if got := w.ArtifactsWithDigest(Digest{3}); got == nil || len(got) != 0 {
+		t.Fatalf("expected an empty, non-nil result, got %#v", got)
+	}
+
+	if err := w.SetArtifactReady(ArtifactInstanceId(uuid.New()), same, cid.Undef, 1); !errors.Is(err, ErrUnknownArtifactInstance) {
+		t.Fatalf("expected ErrUnknownArtifactInstance, got %v", err)
+	}
+}
+
+func TestArtifactInstance_FileMetadata(t *testing.T) {
+	a := &ArtifactInstance{Status: &ArtifactInstance_Status_Pending{}}
+
+	if err := a.SetFileMetadata(0o755, time.Now()); !errors.Is(err, ErrArtifactNotReady) {
+		t.Fatalf("expected ErrArtifactNotReady, got %v", err)
+	}
+	if _, ok := a.FileMetadata(); ok {
+		t.Fatalf("expected metadata of a pending artifact to be unknown")
+	}
+
+	path := filepath.Join(t.TempDir(), "tool")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a.SetReady(Digest{}, cid.Undef, info.Size())
+	if err := a.SetFileMetadata(info.Mode(), info.ModTime()); err != nil {
+		t.Fatalf("SetFileMetadata: %v", err)
+	}
+
+	meta, ok := a.FileMetadata()
+	if !ok {
+		t.Fatalf("expected metadata of a ready artifact")
+	}
+	if !meta.Executable() || meta.Size != info.Size() {
+		t.Fatalf("unexpected metadata %+v", meta)
+	}
+	if !meta.Matches(info) {
+		t.Fatalf("expected the metadata to match the file it was taken from")
+	}
+
+	if err := os.Chmod(path, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if info, err = os.Stat(path); err != nil {
+		t.Fatal(err)
+	}
+	if meta.Matches(info) {
+		t.Fatalf("expected a mode change to invalidate the metadata")
+	}
+}
@@ -0,0 +1,532 @@
+package skycastle
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go.starlark.net/syntax"
+)
+
+var ErrUnsafeFormat = errors.New("formatting would change the file")
+
+const formatIndent = "    "
+
+// Format rewrites a workflow file in canonical form: four-space indentation,
+// one space around binary operators and keyword argument "=", at most one
+// blank line between statements, and one element per line with a trailing
+// comma in any list, dict, tuple or call that spans lines. Keyword arguments
+// are sorted by name when none of their values contains a call, since then
+// reordering cannot change what the file does.
+//
+// The result is parsed again and compared with the input; if its syntax tree
+// or comments differ, such as for a comment in the middle of a line-broken
+// expression, Format returns ErrUnsafeFormat rather than lose anything.
+func Format(filename string, src []byte) ([]byte, error) {
+	file, err := DefaultFileOptions().Parse(filename, src, syntax.RetainComments)
+	if err != nil {
+		return nil, err
+	}
+
+	syntax.Walk(file, func(n syntax.Node) bool {
+		if call, ok := n.(*syntax.CallExpr); ok {
+			sortKeywordArgs(call)
+		}
+		return true
+	})
+
+	p := &formatPrinter{}
+	p.file(file)
+	out := p.buf.Bytes()
+
+	formatted, err := DefaultFileOptions().Parse(filename, out, syntax.RetainComments)
+	if err != nil {
+		return nil, fmt.Errorf("%w: output does not parse: %v", ErrUnsafeFormat, err)
+	}
+	if formatDump(formatted) != formatDump(file) {
+		return nil, fmt.Errorf("%w: syntax tree differs", ErrUnsafeFormat)
+	}
+	if !slices.Equal(formatComments(formatted), formatComments(file)) {
+		return nil, fmt.Errorf("%w: a comment could not be placed", ErrUnsafeFormat)
+	}
+
+	return out, nil
+}
+
+// sortKeywordArgs sorts the keyword arguments of a call by name. It leaves
+// calls with *args or **kwargs alone, and calls where a keyword argument's
+// value contains a call, whose side effects would be reordered.
+func sortKeywordArgs(call *syntax.CallExpr) {
+	first := len(call.Args)
+	for i, arg := range call.Args {
+		switch arg := arg.(type) {
+		case *syntax.UnaryExpr:
+			if arg.Op == syntax.STAR || arg.Op == syntax.STARSTAR {
+				return
+			}
+		case *syntax.BinaryExpr:
+			if arg.Op != syntax.EQ {
+				continue
+			}
+			if containsCall(arg.Y) {
+				return
+			}
+			first = min(first, i)
+		}
+	}
+
+	kwargs := call.Args[first:]
+	slices.SortStableFunc(kwargs, func(a, b syntax.Expr) int {
+		return strings.Compare(keywordName(a), keywordName(b))
+	})
+}
+
+func keywordName(arg syntax.Expr) string {
+	return arg.(*syntax.BinaryExpr).X.(*syntax.Ident).Name
+}
+
+func containsCall(e syntax.Expr) bool {
+	found := false
+	syntax.Walk(e, func(n syntax.Node) bool {
+		if _, ok := n.(*syntax.CallExpr); ok {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// formatDump describes a syntax tree without positions or comments, so two
+// trees that differ only in layout have the same dump.
+func formatDump(file *syntax.File) string {
+	var sb strings.Builder
+	syntax.Walk(file, func(n syntax.Node) bool {
+		fmt.Fprintf(&sb, "%T", n)
+		switch n := n.(type) {
+		case *syntax.Ident:
+			fmt.Fprintf(&sb, " %s", n.Name)
+		case *syntax.Literal:
+			fmt.Fprintf(&sb, " %s", n.Raw)
+		case *syntax.AssignStmt:
+			fmt.Fprintf(&sb, " %s", n.Op)
+		case *syntax.BinaryExpr:
+			fmt.Fprintf(&sb, " %s", n.Op)
+		case *syntax.UnaryExpr:
+			fmt.Fprintf(&sb, " %s %v", n.Op, n.X == nil)
+		case *syntax.BranchStmt:
+			fmt.Fprintf(&sb, " %s", n.Token)
+		case *syntax.Comprehension:
+			fmt.Fprintf(&sb, " %v", n.Curly)
+		case *syntax.TupleExpr:
+			fmt.Fprintf(&sb, " %d", len(n.List))
+		case *syntax.ListExpr:
+			fmt.Fprintf(&sb, " %d", len(n.List))
+		case *syntax.DictExpr:
+			fmt.Fprintf(&sb, " %d", len(n.List))
+		case *syntax.CallExpr:
+			fmt.Fprintf(&sb, " %d", len(n.Args))
+		case *syntax.IfStmt:
+			fmt.Fprintf(&sb, " %d %d", len(n.True), len(n.False))
+		case *syntax.DefStmt:
+			fmt.Fprintf(&sb, " %d %d", len(n.Params), len(n.Body))
+		case *syntax.ForStmt:
+			fmt.Fprintf(&sb, " %d", len(n.Body))
+		case *syntax.WhileStmt:
+			fmt.Fprintf(&sb, " %d", len(n.Body))
+		case *syntax.LambdaExpr:
+			fmt.Fprintf(&sb, " %d", len(n.Params))
+		case *syntax.SliceExpr:
+			fmt.Fprintf(&sb, " %v %v %v", n.Lo != nil, n.Hi != nil, n.Step != nil)
+		case *syntax.ReturnStmt:
+			fmt.Fprintf(&sb, " %v", n.Result != nil)
+		}
+		sb.WriteByte('\n')
+		return true
+	})
+	return sb.String()
+}
+
+// formatComments returns the sorted text of every comment in a file.
+func formatComments(file *syntax.File) []string {
+	var comments []string
+	add := func(c *syntax.Comments) {
+		if c == nil {
+			return
+		}
+		for _, group := range [][]syntax.Comment{c.Before, c.Suffix, c.After} {
+			for _, comment := range group {
+				comments = append(comments, strings.TrimRight(comment.Text, " \t"))
+			}
+		}
+	}
+
+	add(file.Comments())
+	syntax.Walk(file, func(n syntax.Node) bool {
+		// Walk calls f(nil) after finishing each subtree.
+		if n == nil {
+			return true
+		}
+		if _, ok := n.(*syntax.File); !ok {
+			add(n.Comments())
+		}
+		return true
+	})
+
+	slices.Sort(comments)
+	return comments
+}
+
+type formatPrinter struct {
+	buf    bytes.Buffer
+	indent int
+
+	// atLineStart is set after a newline, before the next line's
+	// indentation is written.
+	atLineStart bool
+
+	// suffix holds comments to write at the end of the current line.
+	suffix []syntax.Comment
+}
+
+func (p *formatPrinter) write(s string) {
+	if p.atLineStart {
+		p.buf.WriteString(strings.Repeat(formatIndent, p.indent))
+		p.atLineStart = false
+	}
+	p.buf.WriteString(s)
+}
+
+func (p *formatPrinter) newline() {
+	for _, comment := range p.suffix {
+		p.write("  " + strings.TrimRight(comment.Text, " \t"))
+	}
+	p.suffix = nil
+	p.buf.WriteByte('\n')
+	p.atLineStart = true
+}
+
+// comments writes a node's leading comments on lines of their own, when the
+// node starts a line, and queues its suffix comments for the end of the line
+// it ends on. Comments anywhere else are left for Format's check to catch.
+func (p *formatPrinter) comments(n syntax.Node, print func()) {
+	c := n.Comments()
+	if c != nil && p.atLineStart {
+		start, _ := n.Span()
+		for i, comment := range c.Before {
+			p.write(strings.TrimRight(comment.Text, " \t"))
+			p.newline()
+
+			next := start.Line
+			if i+1 < len(c.Before) {
+				next = c.Before[i+1].Start.Line
+			}
+			if next-comment.Start.Line > 1 {
+				p.newline()
+			}
+		}
+	}
+
+	print()
+
+	if c != nil {
+		p.suffix = append(p.suffix, c.Suffix...)
+	}
+}
+
+func (p *formatPrinter) file(file *syntax.File) {
+	p.atLineStart = true
+	p.stmts(file.Stmts)
+
+	if c := file.Comments(); c != nil && len(c.After) > 0 {
+		if len(file.Stmts) > 0 {
+			_, end := file.Stmts[len(file.Stmts)-1].Span()
+			if c.After[0].Start.Line-end.Line > 1 {
+				p.newline()
+			}
+		}
+		for _, comment := range c.After {
+			p.write(strings.TrimRight(comment.Text, " \t"))
+			p.newline()
+		}
+	}
+}
+
+func (p *formatPrinter) stmts(stmts []syntax.Stmt) {
+	for i, stmt := range stmts {
+		if i > 0 {
+			_, prevEnd := stmts[i-1].Span()
+			if stmtStartLine(stmt)-prevEnd.Line > 1 {
+				p.newline()
+			}
+		}
+		p.comments(stmt, func() { p.stmt(stmt) })
+		if !p.atLineStart {
+			p.newline()
+		}
+	}
+}
+
+// stmtStartLine is the line a statement's leading comments start on, or the
+// statement's own line if it has none.
+func stmtStartLine(stmt syntax.Stmt) int32 {
+	if c := stmt.Comments(); c != nil && len(c.Before) > 0 {
+		return c.Before[0].Start.Line
+	}
+	start, _ := stmt.Span()
+	return start.Line
+}
+
+func (p *formatPrinter) block(stmts []syntax.Stmt) {
+	p.write(":")
+	p.newline()
+	p.indent++
+	p.stmts(stmts)
+	p.indent--
+}
+
+func (p *formatPrinter) stmt(stmt syntax.Stmt) {
+	switch stmt := stmt.(type) {
+	case *syntax.ExprStmt:
+		p.expr(stmt.X)
+
+	case *syntax.AssignStmt:
+		p.expr(stmt.LHS)
+		p.write(" " + stmt.Op.String() + " ")
+		p.expr(stmt.RHS)
+
+	case *syntax.BranchStmt:
+		p.write(stmt.Token.String())
+
+	case *syntax.ReturnStmt:
+		p.write("return")
+		if stmt.Result != nil {
+			p.write(" ")
+			p.expr(stmt.Result)
+		}
+
+	case *syntax.LoadStmt:
+		p.write("load(")
+		p.expr(stmt.Module)
+		for i := range stmt.To {
+			p.write(", ")
+			if stmt.To[i].Name == stmt.From[i].Name {
+				p.write(strconv.Quote(stmt.From[i].Name))
+			} else {
+				p.write(stmt.To[i].Name + " = " + strconv.Quote(stmt.From[i].Name))
+			}
+		}
+		p.write(")")
+
+	case *syntax.DefStmt:
+		p.write("def ")
+		p.expr(stmt.Name)
+		p.list("(", stmt.Params, ")", stmt.Lparen, stmt.Rparen, false)
+		p.block(stmt.Body)
+
+	case *syntax.IfStmt:
+		p.ifStmt(stmt, "if")
+
+	case *syntax.ForStmt:
+		p.write("for ")
+		p.expr(stmt.Vars)
+		p.write(" in ")
+		p.expr(stmt.X)
+		p.block(stmt.Body)
+
+	case *syntax.WhileStmt:
+		p.write("while ")
+		p.expr(stmt.Cond)
+		p.block(stmt.Body)
+
+	default:
+		panic(fmt.Sprintf("unexpected statement %T", stmt))
+	}
+}
+
+func (p *formatPrinter) ifStmt(stmt *syntax.IfStmt, keyword string) {
+	p.write(keyword + " ")
+	p.expr(stmt.Cond)
+	p.block(stmt.True)
+
+	if len(stmt.False) == 0 {
+		return
+	}
+
+	// An elif is parsed as an else holding a single if that starts at the
+	// elif keyword.
+	if elif, ok := stmt.False[0].(*syntax.IfStmt); ok && len(stmt.False) == 1 && elif.If == stmt.ElsePos {
+		p.comments(elif, func() { p.ifStmt(elif, "elif") })
+		return
+	}
+
+	p.write("else")
+	p.block(stmt.False)
+}
+
+// list writes a bracketed, comma-separated list of expressions: on one line
+// if it was written on one line, and otherwise one element per line with a
+// trailing comma. A one-element tuple keeps the comma that makes it a tuple.
+func (p *formatPrinter) list(open string, elems []syntax.Expr, close string, lbrack, rbrack syntax.Position, tuple bool) {
+	p.write(open)
+
+	if lbrack.Line == rbrack.Line || len(elems) == 0 {
+		for i, elem := range elems {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.expr(elem)
+		}
+		if tuple && len(elems) == 1 {
+			p.write(",")
+		}
+		p.write(close)
+		return
+	}
+
+	p.indent++
+	for _, elem := range elems {
+		p.newline()
+		p.expr(elem)
+		p.write(",")
+	}
+	p.indent--
+	p.newline()
+	p.write(close)
+}
+
+func (p *formatPrinter) expr(e syntax.Expr) {
+	p.comments(e, func() { p.exprNoComments(e) })
+}
+
+func (p *formatPrinter) exprNoComments(e syntax.Expr) {
+	switch e := e.(type) {
+	case *syntax.Ident:
+		p.write(e.Name)
+
+	case *syntax.Literal:
+		p.write(e.Raw)
+
+	case *syntax.ParenExpr:
+		p.write("(")
+		p.expr(e.X)
+		p.write(")")
+
+	case *syntax.CallExpr:
+		p.expr(e.Fn)
+		p.list("(", e.Args, ")", e.Lparen, e.Rparen, false)
+
+	case *syntax.DotExpr:
+		p.expr(e.X)
+		p.write(".")
+		p.expr(e.Name)
+
+	case *syntax.IndexExpr:
+		p.expr(e.X)
+		p.write("[")
+		p.expr(e.Y)
+		p.write("]")
+
+	case *syntax.SliceExpr:
+		p.expr(e.X)
+		p.write("[")
+		if e.Lo != nil {
+			p.expr(e.Lo)
+		}
+		p.write(":")
+		if e.Hi != nil {
+			p.expr(e.Hi)
+		}
+		if e.Step != nil {
+			p.write(":")
+			p.expr(e.Step)
+		}
+		p.write("]")
+
+	case *syntax.ListExpr:
+		p.list("[", e.List, "]", e.Lbrack, e.Rbrack, false)
+
+	case *syntax.DictExpr:
+		p.list("{", e.List, "}", e.Lbrace, e.Rbrace, false)
+
+	case *syntax.DictEntry:
+		p.expr(e.Key)
+		p.write(": ")
+		p.expr(e.Value)
+
+	case *syntax.TupleExpr:
+		if e.Lparen.IsValid() {
+			p.list("(", e.List, ")", e.Lparen, e.Rparen, true)
+			return
+		}
+		for i, elem := range e.List {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.expr(elem)
+		}
+		if len(e.List) == 1 {
+			p.write(",")
+		}
+
+	case *syntax.Comprehension:
+		open, close := "[", "]"
+		if e.Curly {
+			open, close = "{", "}"
+		}
+		p.write(open)
+		p.expr(e.Body)
+		for _, clause := range e.Clauses {
+			switch clause := clause.(type) {
+			case *syntax.ForClause:
+				p.write(" for ")
+				p.expr(clause.Vars)
+				p.write(" in ")
+				p.expr(clause.X)
+			case *syntax.IfClause:
+				p.write(" if ")
+				p.expr(clause.Cond)
+			}
+		}
+		p.write(close)
+
+	case *syntax.CondExpr:
+		p.expr(e.True)
+		p.write(" if ")
+		p.expr(e.Cond)
+		p.write(" else ")
+		p.expr(e.False)
+
+	case *syntax.LambdaExpr:
+		p.write("lambda")
+		for i, param := range e.Params {
+			if i == 0 {
+				p.write(" ")
+			} else {
+				p.write(", ")
+			}
+			p.expr(param)
+		}
+		p.write(": ")
+		p.expr(e.Body)
+
+	case *syntax.UnaryExpr:
+		p.write(e.Op.String())
+		if e.Op == syntax.NOT {
+			p.write(" ")
+		}
+		if e.X != nil {
+			p.expr(e.X)
+		}
+
+	case *syntax.BinaryExpr:
+		p.expr(e.X)
+		p.write(" " + e.Op.String() + " ")
+		p.expr(e.Y)
+
+	default:
+		panic(fmt.Sprintf("unexpected expression %T", e))
+	}
+}
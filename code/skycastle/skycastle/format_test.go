@@ -0,0 +1,81 @@
+package skycastle
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFormat_Canonicalizes(t *testing.T) {
+	src := `# Build the server.
+load("//lib.star",   "helper")
+src=file(path="main.go",description="sources")
+
+
+build = action(command="go build", description = "build",
+  inputs={"SRC":src},   # the sources
+  outputs = {"BIN": file()})
+if  True :
+  x=[1,2,
+  3]
+`
+
+	want := `# Build the server.
+load("//lib.star", "helper")
+src = file(description = "sources", path = "main.go")
+
+build = action(
+    command = "go build",
+    description = "build",
+    inputs = {"SRC": src},  # the sources
+    outputs = {"BIN": file()},
+)
+if True:
+    x = [
+        1,
+        2,
+        3,
+    ]
+`
+
+	got, err := Format("BUILD.star", []byte(src))
+	if err != nil {
+		t.Fatalf("Format: %v", err)
+	}
+	if string(got) != want {
+		t.Fatalf("unexpected format:\n got:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Formatted files are left unchanged, which is what fmt --check relies
+	// on to pass.
+	again, err := Format("BUILD.star", got)
+	if err != nil {
+		t.Fatalf("Format of formatted output: %v", err)
+	}
+	if string(again) != string(got) {
+		t.Fatalf("Format is not idempotent:\n got:\n%s\nwant:\n%s", again, got)
+	}
+}
+
+func TestFormat_KeepsKeywordOrderWhenValuesCall(t *testing.T) {
+	src := "action(command = \"b\", description = describe())\n" +
+		"action(outputs = {\"OUT\": file()}, command = \"a\")\n"
+
+	got, err := Format("BUILD.star", []byte(src))
+	if err != nil {
+		t.Fatalf("Format: %v", err)
+	}
+	if string(got) != src {
+		t.Fatalf("expected keyword order to be kept, got:\n%s", got)
+	}
+}
+
+func TestFormat_RefusesToMoveInlineComments(t *testing.T) {
+	src := `x = (1 +
+    # one more
+    2)
+`
+
+	if _, err := Format("BUILD.star", []byte(src)); !errors.Is(err, ErrUnsafeFormat) {
+		t.Fatalf("expected ErrUnsafeFormat, got %v", err)
+	}
+}
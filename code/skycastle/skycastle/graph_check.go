@@ -0,0 +1,92 @@
+package skycastle
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+var ErrInconsistentGraph = errors.New("inconsistent graph")
+
+// Check verifies the referential integrity of the graph: every artifact and
+// action is stored under its own id, every artifact has valid metadata for
+// its kind, every input, output and dep of an action names an existing
+// artifact, no artifact has two producers or is both an input and an output
+// of one action, declared input orders name inputs, and the graph has no
+// cycles. The builder and Build maintain all of this; Check is for graphs
+// that arrive some other way, such as an imported export.
+//
+// Every problem found is reported, each wrapping ErrInconsistentGraph.
+func (g *WorkflowGraph) Check() error {
+	var problems []error
+	report := func(format string, args ...any) {
+		problems = append(problems, fmt.Errorf("%w: "+format, append([]any{ErrInconsistentGraph}, args...)...))
+	}
+
+	nodeIds := slices.SortedFunc(maps.Keys(g.Nodes), func(a, b NodeId) int {
+		return strings.Compare(Unique(a).String(), Unique(b).String())
+	})
+	for _, id := range nodeIds {
+		node := g.Nodes[id]
+		if node.Id != id {
+			report("artifact %s is stored under %s", Unique(node.Id).String(), Unique(id).String())
+		}
+		if err := node.Validate(); err != nil {
+			report("artifact %s: %v", Unique(id).String(), err)
+		}
+	}
+
+	producers := make(map[NodeId]EdgeId)
+	for _, id := range sortedEdgeIds(g) {
+		edge := g.Edges[id]
+		action := Unique(id).String()
+		if edge.Id != id {
+			report("action %s is stored under %s", Unique(edge.Id).String(), action)
+		}
+
+		for _, port := range slices.Sorted(maps.Keys(edge.Inputs)) {
+			artifact := edge.Inputs[port]
+			if _, ok := g.Nodes[artifact]; !ok {
+				report("action %s: input %s references missing artifact %s", action, port, Unique(artifact).String())
+			}
+		}
+		for _, port := range slices.Sorted(maps.Keys(edge.Outputs)) {
+			artifact := edge.Outputs[port]
+			if _, ok := g.Nodes[artifact]; !ok {
+				report("action %s: output %s references missing artifact %s", action, port, Unique(artifact).String())
+			}
+			if other, ok := producers[artifact]; ok && other != id {
+				report("artifact %s is produced by both action %s and action %s", Unique(artifact).String(), Unique(other).String(), action)
+			}
+			producers[artifact] = id
+			if slices.Contains(g.dependencies(id), artifact) {
+				report("action %s both consumes and produces artifact %s", action, Unique(artifact).String())
+			}
+		}
+		for _, dep := range edge.Deps {
+			if _, ok := g.Nodes[dep]; !ok {
+				report("action %s: dep references missing artifact %s", action, Unique(dep).String())
+			}
+		}
+
+		for i, port := range edge.InputOrder {
+			if _, ok := edge.Inputs[port]; !ok {
+				report("action %s: input order names %s, which is not an input", action, port)
+			}
+			if slices.Contains(edge.InputOrder[:i], port) {
+				report("action %s: input order names %s more than once", action, port)
+			}
+		}
+	}
+
+	// Cycles are only looked for once every reference resolves.
+	if len(problems) == 0 {
+		if err := g.Validate(); err != nil {
+			problems = append(problems, fmt.Errorf("%w: %w", ErrInconsistentGraph, err))
+		}
+	}
+
+	return errors.Join(problems...)
+}
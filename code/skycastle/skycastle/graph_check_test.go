@@ -0,0 +1,78 @@
+package skycastle
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCheck_ReportsEveryProblem(t *testing.T) {
+	b := NewWorkflowGraphBuilder()
+
+	src := b.AddFileArtifact(WithArtifactDescription("src"))
+	build := b.AddAction("build")
+	if err := b.AddInput(build, Port("SRC"), src); err != nil {
+		t.Fatalf("AddInput: %v", err)
+	}
+	bin, err := b.AddOutputFile(build, Port("BIN"))
+	if err != nil {
+		t.Fatalf("AddOutputFile: %v", err)
+	}
+	test := b.AddAction("test")
+	if err := b.AddInput(test, Port("BIN"), bin); err != nil {
+		t.Fatalf("AddInput: %v", err)
+	}
+
+	g := b.Cospan.Apex
+	if err := g.Check(); err != nil {
+		t.Fatalf("expected a built graph to check clean, got %v", err)
+	}
+
+	// Corrupt the graph the way a damaged export might.
+	missing := NodeId(NewUnique())
+	testEdge := g.Edges[b.ActionHandles[test]]
+	testEdge.Inputs[Port("GONE")] = missing
+	testEdge.Outputs[Port("BIN")] = b.ArtifactHandles[bin]
+	testEdge.InputOrder = []Port{"NOPE"}
+	g.Edges[b.ActionHandles[test]] = testEdge
+
+	err = g.Check()
+	if !errors.Is(err, ErrInconsistentGraph) {
+		t.Fatalf("expected ErrInconsistentGraph, got %v", err)
+	}
+	for _, want := range []string{
+		"input GONE references missing artifact",
+		"is produced by both action",
+		"both consumes and produces",
+		"input order names NOPE",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected %q to be reported, got:\n%v", want, err)
+		}
+	}
+}
+
+func TestCheck_ReportsCycles(t *testing.T) {
+	b := NewWorkflowGraphBuilder()
+
+	first := b.AddAction("first")
+	second := b.AddAction("second")
+	x, err := b.AddOutputFile(first, Port("OUT"))
+	if err != nil {
+		t.Fatalf("AddOutputFile: %v", err)
+	}
+	if err := b.AddInput(second, Port("IN"), x); err != nil {
+		t.Fatalf("AddInput: %v", err)
+	}
+	y, err := b.AddOutputFile(second, Port("OUT"))
+	if err != nil {
+		t.Fatalf("AddOutputFile: %v", err)
+	}
+
+	g := b.Cospan.Apex
+	g.Edges[b.ActionHandles[first]].Inputs[Port("BACK")] = b.ArtifactHandles[y]
+
+	if err := g.Check(); !errors.Is(err, ErrInconsistentGraph) || !errors.Is(err, ErrCycle) {
+		t.Fatalf("expected an inconsistent graph with a cycle, got %v", err)
+	}
+}
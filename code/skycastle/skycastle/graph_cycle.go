@@ -0,0 +1,266 @@
+package skycastle
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+var ErrCycle = errors.New("dependency cycle")
+
+// Cycle is a dependency cycle between actions: Actions[i] produces
+// Artifacts[i], which Actions[i+1] consumes, and the last artifact is
+// consumed by the first action.
+type Cycle struct {
+	Actions   []EdgeId
+	Artifacts []NodeId
+}
+
+// CycleError reports a dependency cycle found in a workflow graph.
+type CycleError struct {
+	Graph *WorkflowGraph
+	Cycle Cycle
+}
+
+func (e *CycleError) Error() string {
+	var sb strings.Builder
+	sb.WriteString(ErrCycle.Error())
+	sb.WriteString(": ")
+	for i, action := range e.Cycle.Actions {
+		fmt.Fprintf(&sb, "%s -> %s -> ", e.Graph.actionLabel(action), e.Graph.artifactLabel(e.Cycle.Artifacts[i]))
+	}
+	sb.WriteString(e.Graph.actionLabel(e.Cycle.Actions[0]))
+	return sb.String()
+}
+
+func (e *CycleError) Unwrap() error {
+	return ErrCycle
+}
+
+// Validate checks that the graph is a DAG, returning a *CycleError naming the
+// actions and artifacts of a cycle if it is not.
+func (g *WorkflowGraph) Validate() error {
+	if cycle, ok := g.FindCycle(); ok {
+		return &CycleError{Graph: g, Cycle: cycle}
+	}
+	return nil
+}
+
+// FindCycle searches the graph for a dependency cycle, reporting the first
+// one found. The search visits actions and ports in a fixed order, so the
+// same graph always reports the same cycle.
+func (g *WorkflowGraph) FindCycle() (Cycle, bool) {
+	producers := g.producerIndex()
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[EdgeId]int, len(g.Edges))
+
+	// The current DFS path: path[i] consumes via[i], which path[i+1]
+	// produces. Dependencies are followed from consumers to producers.
+	var path []EdgeId
+	var via []NodeId
+
+	var visit func(id EdgeId) (Cycle, bool)
+	visit = func(id EdgeId) (Cycle, bool) {
+		state[id] = visiting
+		path = append(path, id)
+
+		for _, artifact := range g.dependencies(id) {
+			producer, ok := producers[artifact]
+			if !ok {
+				continue
+			}
+
+			switch state[producer] {
+			case visiting:
+				start := slices.Index(path, producer)
+				return cycleFromPath(path[start:], append(slices.Clone(via[start:]), artifact)), true
+			case unvisited:
+				via = append(via, artifact)
+				if cycle, ok := visit(producer); ok {
+					return cycle, true
+				}
+				via = via[:len(via)-1]
+			}
+		}
+
+		path = path[:len(path)-1]
+		state[id] = visited
+		return Cycle{}, false
+	}
+
+	for _, id := range sortedEdgeIds(g) {
+		if state[id] != unvisited {
+			continue
+		}
+		if cycle, ok := visit(id); ok {
+			return cycle, true
+		}
+	}
+	return Cycle{}, false
+}
+
+// checkLink returns a *CycleError if making producer produce artifact and
+// consumer consume it would close a dependency cycle, which it does when
+// producer already depends, directly or transitively, on consumer.
+func (b *WorkflowGraphBuilder) checkLink(producer EdgeId, artifact NodeId, consumer EdgeId) error {
+	g := b.Cospan.Apex
+	index := b.wiring()
+
+	// An action consuming its own output is a cycle by itself, which the
+	// shortcut below, looking for other actions in between, would miss.
+	if producer == consumer {
+		return &CycleError{Graph: g, Cycle: Cycle{Actions: []EdgeId{producer}, Artifacts: []NodeId{artifact}}}
+	}
+
+	// An action that consumes nothing depends on nothing, and nothing
+	// depends on one whose outputs are not consumed.
+	if len(g.dependencies(producer)) == 0 || !index.anyConsumed(g.Edges[consumer].Outputs) {
+		return nil
+	}
+
+	actions, artifacts, ok := g.dependencyPath(producer, consumer, index.producer)
+	if !ok {
+		return nil
+	}
+
+	// The path runs from producer back to consumer; the new link closes it,
+	// so the cycle in production order is producer, consumer and then the
+	// rest of the path backwards.
+	cycle := Cycle{
+		Actions:   []EdgeId{producer},
+		Artifacts: []NodeId{artifact},
+	}
+	for i := len(actions) - 1; i > 0; i-- {
+		cycle.Actions = append(cycle.Actions, actions[i])
+		cycle.Artifacts = append(cycle.Artifacts, artifacts[i-1])
+	}
+	return &CycleError{Graph: g, Cycle: cycle}
+}
+
+// checkConsumer returns a *CycleError if making consumer consume artifact
+// would close a dependency cycle.
+func (b *WorkflowGraphBuilder) checkConsumer(consumer EdgeId, artifact NodeId) error {
+	producer, ok := b.wiring().producer(artifact)
+	if !ok {
+		return nil
+	}
+	return b.checkLink(producer, artifact, consumer)
+}
+
+// checkProducer returns a *CycleError if making producer produce artifact
+// would close a dependency cycle through any of the artifact's consumers.
+func (b *WorkflowGraphBuilder) checkProducer(producer EdgeId, artifact NodeId) error {
+	for _, consumer := range b.wiring().consumersOf(artifact) {
+		if err := b.checkLink(producer, artifact, consumer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dependencyPath searches for a way in which action from depends on action
+// to. It returns the actions along the path, starting with from and ending
+// with to, and the artifacts linking them: actions[i] consumes artifacts[i],
+// which actions[i+1] produces.
+func (g *WorkflowGraph) dependencyPath(from, to EdgeId, producerOf func(NodeId) (EdgeId, bool)) ([]EdgeId, []NodeId, bool) {
+	visited := make(map[EdgeId]bool)
+	path := []EdgeId{from}
+	var via []NodeId
+
+	var visit func(id EdgeId) bool
+	visit = func(id EdgeId) bool {
+		if id == to {
+			return true
+		}
+		visited[id] = true
+
+		for _, artifact := range g.dependencies(id) {
+			producer, ok := producerOf(artifact)
+			if !ok || visited[producer] {
+				continue
+			}
+
+			path = append(path, producer)
+			via = append(via, artifact)
+			if visit(producer) {
+				return true
+			}
+			path = path[:len(path)-1]
+			via = via[:len(via)-1]
+		}
+		return false
+	}
+
+	if !visit(from) {
+		return nil, nil, false
+	}
+	return path, via, true
+}
+
+// producerIndex maps every produced artifact to the action producing it.
+func (g *WorkflowGraph) producerIndex() map[NodeId]EdgeId {
+	producers := make(map[NodeId]EdgeId)
+	for id, edge := range g.Edges {
+		for _, artifact := range edge.Outputs {
+			producers[artifact] = id
+		}
+	}
+	return producers
+}
+
+// cycleFromPath turns a closed path of consumers, where consumers[i]
+// consumes consumed[i] and consumers[i+1] (wrapping around) produces it, into
+// a Cycle in production order starting from consumers[0].
+func cycleFromPath(consumers []EdgeId, consumed []NodeId) Cycle {
+	actions := []EdgeId{consumers[0]}
+	for i := len(consumers) - 1; i > 0; i-- {
+		actions = append(actions, consumers[i])
+	}
+	artifacts := slices.Clone(consumed)
+	slices.Reverse(artifacts)
+	return Cycle{Actions: actions, Artifacts: artifacts}
+}
+
+// dependencies returns the artifacts an action consumes, inputs in port order
+// followed by deps.
+func (g *WorkflowGraph) dependencies(id EdgeId) []NodeId {
+	edge := g.Edges[id]
+	deps := make([]NodeId, 0, len(edge.Inputs)+len(edge.Deps))
+	for _, port := range slices.Sorted(maps.Keys(edge.Inputs)) {
+		deps = append(deps, edge.Inputs[port])
+	}
+	return append(deps, edge.Deps...)
+}
+
+func sortedEdgeIds(g *WorkflowGraph) []EdgeId {
+	return slices.SortedFunc(maps.Keys(g.Edges), func(a, b EdgeId) int {
+		return strings.Compare(Unique(a).String(), Unique(b).String())
+	})
+}
+
+func (g *WorkflowGraph) actionLabel(id EdgeId) string {
+	edge := g.Edges[id]
+	if edge.Description != "" {
+		return fmt.Sprintf("action %q", edge.Description)
+	}
+	return fmt.Sprintf("action %q", edge.Command)
+}
+
+func (g *WorkflowGraph) artifactLabel(id NodeId) string {
+	node := g.Nodes[id]
+	switch {
+	case node.Description != "":
+		return fmt.Sprintf("artifact %q", node.Description)
+	case node.Path != "":
+		return fmt.Sprintf("artifact %q", node.Path)
+	default:
+		return fmt.Sprintf("artifact %s", Unique(id).Short())
+	}
+}
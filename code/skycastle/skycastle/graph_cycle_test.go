@@ -0,0 +1,242 @@
+package skycastle
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestValidate_ReportsCycleMembers(t *testing.T) {
+	b := NewWorkflowGraphBuilder()
+
+	src := b.AddFileArtifact(WithArtifactDescription("src"))
+	x := b.AddFileArtifact(WithArtifactDescription("x"))
+	y := b.AddFileArtifact(WithArtifactDescription("y"))
+
+	first := b.AddAction("first")
+	second := b.AddAction("second")
+
+	_ = b.AddInput(first, Port("SRC"), src)
+	_ = b.AddOutput(first, Port("OUT"), x)
+	_ = b.AddInput(second, Port("IN"), x)
+	_ = b.AddOutput(second, Port("OUT"), y)
+
+	if err := b.Cospan.Apex.Validate(); err != nil {
+		t.Fatalf("expected an acyclic graph, got %v", err)
+	}
+
+	// The builder refuses to feed second's output back into first.
+	if err := b.AddInput(first, Port("BACK"), y); !errors.Is(err, ErrCycle) {
+		t.Fatalf("expected AddInput to reject the cycle, got %v", err)
+	}
+
+	// Graphs that bypass the builder, such as imported ones, can still hold
+	// a cycle, which Validate reports.
+	firstId := b.ActionHandles[first]
+	b.Cospan.Apex.Edges[firstId].Inputs[Port("BACK")] = b.ArtifactHandles[y]
+
+	err := b.Cospan.Apex.Validate()
+	if !errors.Is(err, ErrCycle) {
+		t.Fatalf("expected ErrCycle, got %v", err)
+	}
+
+	var cycleErr *CycleError
+	if !errors.As(err, &cycleErr) {
+		t.Fatalf("expected *CycleError, got %T", err)
+	}
+
+	cycle := cycleErr.Cycle
+	if len(cycle.Actions) != 2 || len(cycle.Artifacts) != 2 {
+		t.Fatalf("expected a cycle of two actions and two artifacts, got %+v", cycle)
+	}
+
+	// Each action must produce the artifact that follows it, which the next
+	// action consumes.
+	graph := b.Cospan.Apex
+	for i, action := range cycle.Actions {
+		artifact := cycle.Artifacts[i]
+		next := cycle.Actions[(i+1)%len(cycle.Actions)]
+
+		produced := false
+		for _, out := range graph.Edges[action].Outputs {
+			produced = produced || out == artifact
+		}
+		consumed := false
+		for _, in := range graph.Edges[next].Inputs {
+			consumed = consumed || in == artifact
+		}
+		if !produced || !consumed {
+			t.Fatalf("cycle step %d is not a produce/consume link: %+v", i, cycle)
+		}
+	}
+
+	members := map[EdgeId]bool{}
+	for _, action := range cycle.Actions {
+		members[action] = true
+	}
+	if !members[b.ActionHandles[first]] || !members[b.ActionHandles[second]] {
+		t.Fatalf("expected both actions in the cycle, got %+v", cycle)
+	}
+
+	if _, err := b.Build(Target{Path: Path[Relative, File]{path: "p"}, Name: "t"}, []ArtifactHandle{y}, nil); !errors.Is(err, ErrCycle) {
+		t.Fatalf("expected Build to reject the cycle, got %v", err)
+	}
+}
+
+func TestWiring_RejectsCycles(t *testing.T) {
+	b := NewWorkflowGraphBuilder()
+
+	a := b.AddFileArtifact(WithArtifactDescription("a"))
+	x := b.AddFileArtifact(WithArtifactDescription("x"))
+	y := b.AddFileArtifact(WithArtifactDescription("y"))
+	z := b.AddFileArtifact(WithArtifactDescription("z"))
+
+	first := b.AddAction("first")
+	second := b.AddAction("second")
+	third := b.AddAction("third")
+
+	// first -> x -> second -> y -> third -> z
+	for _, err := range []error{
+		b.AddInput(first, Port("IN"), a),
+		b.AddOutput(first, Port("OUT"), x),
+		b.AddInput(second, Port("IN"), x),
+		b.AddOutput(second, Port("OUT"), y),
+		b.AddDep(third, y),
+		b.AddOutput(third, Port("OUT"), z),
+	} {
+		if err != nil {
+			t.Fatalf("wiring an acyclic graph: %v", err)
+		}
+	}
+
+	cycleOf := func(err error) Cycle {
+		t.Helper()
+		var cycleErr *CycleError
+		if !errors.As(err, &cycleErr) {
+			t.Fatalf("expected *CycleError, got %v", err)
+		}
+		return cycleErr.Cycle
+	}
+	ids := func(handles ...ActionHandle) []EdgeId {
+		var ids []EdgeId
+		for _, h := range handles {
+			ids = append(ids, b.ActionHandles[h])
+		}
+		return ids
+	}
+	nodes := func(handles ...ArtifactHandle) []NodeId {
+		var ids []NodeId
+		for _, h := range handles {
+			ids = append(ids, b.ArtifactHandles[h])
+		}
+		return ids
+	}
+
+	// Consuming z makes first depend on its own output through second and
+	// third. The path names every action and artifact on the way round.
+	cycle := cycleOf(b.AddInput(first, Port("BACK"), z))
+	if !slices.Equal(cycle.Actions, ids(third, first, second)) || !slices.Equal(cycle.Artifacts, nodes(z, x, y)) {
+		t.Fatalf("unexpected cycle %+v", cycle)
+	}
+
+	if err := b.AddInputs(first, map[Port]ArtifactHandle{"BACK": z}); !errors.Is(err, ErrCycle) {
+		t.Fatalf("expected AddInputs to reject the cycle, got %v", err)
+	}
+	if err := b.AddDep(first, y); !errors.Is(err, ErrCycle) {
+		t.Fatalf("expected AddDep to reject the cycle, got %v", err)
+	}
+
+	// Producing an artifact that first already consumes closes the same
+	// kind of loop from the other end.
+	cycle = cycleOf(b.AddOutput(third, Port("A"), a))
+	if !slices.Equal(cycle.Actions, ids(third, first, second)) || !slices.Equal(cycle.Artifacts, nodes(a, x, y)) {
+		t.Fatalf("unexpected cycle %+v", cycle)
+	}
+
+	// Nothing was wired by the rejected calls.
+	if err := b.Cospan.Apex.Validate(); err != nil {
+		t.Fatalf("expected the graph to stay acyclic, got %v", err)
+	}
+	if _, ok := b.Cospan.Apex.Edges[b.ActionHandles[first]].Inputs["BACK"]; ok {
+		t.Fatalf("expected the rejected input not to be wired")
+	}
+}
+
+func TestWiring_FollowsRewiredPorts(t *testing.T) {
+	b := NewWorkflowGraphBuilder()
+
+	a := b.AddFileArtifact()
+	x := b.AddFileArtifact()
+	y := b.AddFileArtifact()
+
+	first := b.AddAction("first")
+	second := b.AddAction("second")
+
+	// first -> x -> second -> y
+	for _, err := range []error{
+		b.AddInput(first, Port("IN"), a),
+		b.AddOutput(first, Port("OUT"), x),
+		b.AddInput(second, Port("IN"), x),
+		b.AddOutput(second, Port("OUT"), y),
+	} {
+		if err != nil {
+			t.Fatalf("wiring an acyclic graph: %v", err)
+		}
+	}
+	if err := b.AddInput(first, Port("BACK"), y); !errors.Is(err, ErrCycle) {
+		t.Fatalf("expected a cycle through x, got %v", err)
+	}
+
+	// Once second reads a instead of x, it no longer depends on first, and
+	// neither does the old output of first once that port is rebound.
+	if err := b.AddInput(second, Port("IN"), a); err != nil {
+		t.Fatalf("AddInput: %v", err)
+	}
+	if err := b.AddInput(first, Port("BACK"), y); err != nil {
+		t.Fatalf("expected no cycle after rewiring, got %v", err)
+	}
+	z := b.AddFileArtifact()
+	if err := b.AddOutput(first, Port("OUT"), z); err != nil {
+		t.Fatalf("AddOutput: %v", err)
+	}
+	if err := b.AddOutput(second, Port("X"), x); err != nil {
+		t.Fatalf("expected x to have no producer after rebinding, got %v", err)
+	}
+}
+
+func BenchmarkWiring_Chain_1000(b *testing.B) {
+	for b.Loop() {
+		builder := NewWorkflowGraphBuilder()
+		previous := builder.AddFileArtifact()
+		for range 1000 {
+			act := builder.AddAction("true")
+			next := builder.AddFileArtifact()
+			if err := builder.AddInput(act, Port("IN"), previous); err != nil {
+				b.Fatal(err)
+			}
+			if err := builder.AddOutput(act, Port("OUT"), next); err != nil {
+				b.Fatal(err)
+			}
+			previous = next
+		}
+	}
+}
+
+func TestCheckLink_ReportsOneActionCycle(t *testing.T) {
+	b := NewWorkflowGraphBuilder()
+	act := b.AddAction("touch $X")
+	x := b.AddFileArtifact()
+
+	// Wire the output behind the builder's back, so the self-dependency
+	// guards are bypassed and only the cycle check is left.
+	actionId, artifactId := b.ActionHandles[act], b.ArtifactHandles[x]
+	b.Cospan.Apex.Edges[actionId].Outputs["OUT"] = artifactId
+
+	var cycleErr *CycleError
+	if err := b.checkConsumer(actionId, artifactId); !errors.As(err, &cycleErr) {
+		t.Fatalf("expected *CycleError, got %v", err)
+	}
+	if !slices.Equal(cycleErr.Cycle.Actions, []EdgeId{actionId}) || !slices.Equal(cycleErr.Cycle.Artifacts, []NodeId{artifactId}) {
+		t.Fatalf("unexpected cycle %+v", cycleErr.Cycle)
+	}
+}
@@ -0,0 +1,74 @@
+package skycastle
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// ExportDOT writes the graph in Graphviz DOT format. Artifacts are ellipses
+// labelled with their description or path and their kind, actions are boxes
+// labelled with their description or command, and edges carry the port they
+// are wired to. Deps, which have no port, are drawn dashed. Nodes and edges
+// are written in a fixed order, so the same graph always renders the same.
+func (g *WorkflowGraph) ExportDOT(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintln(bw, "digraph workflow {")
+	fmt.Fprintln(bw, "  rankdir=LR;")
+
+	nodeIds := slices.SortedFunc(maps.Keys(g.Nodes), func(a, b NodeId) int {
+		return strings.Compare(Unique(a).String(), Unique(b).String())
+	})
+	for _, id := range nodeIds {
+		node := g.Nodes[id]
+		if !node.Kind.Valid() {
+			return fmt.Errorf("%w: %d", ErrInvalidArtifactKind, node.Kind)
+		}
+		name := node.Description
+		if name == "" {
+			name = node.Path
+		}
+		if name == "" {
+			name = Unique(id).Short()
+		}
+		fmt.Fprintf(bw, "  %s [shape=ellipse, label=%s];\n", dotQuote(Unique(id).String()), dotQuote(name+"\n"+node.Kind.String()))
+	}
+
+	for _, id := range sortedEdgeIds(g) {
+		edge := g.Edges[id]
+		action := dotQuote(Unique(id).String())
+		name := edge.Description
+		if name == "" {
+			name = edge.Command
+		}
+		fmt.Fprintf(bw, "  %s [shape=box, label=%s];\n", action, dotQuote(name))
+
+		for _, port := range slices.Sorted(maps.Keys(edge.Inputs)) {
+			fmt.Fprintf(bw, "  %s -> %s [label=%s];\n", dotQuote(Unique(edge.Inputs[port]).String()), action, dotQuote(string(port)))
+		}
+		for _, dep := range edge.Deps {
+			fmt.Fprintf(bw, "  %s -> %s [style=dashed];\n", dotQuote(Unique(dep).String()), action)
+		}
+		for _, port := range slices.Sorted(maps.Keys(edge.Outputs)) {
+			fmt.Fprintf(bw, "  %s -> %s [label=%s];\n", action, dotQuote(Unique(edge.Outputs[port]).String()), dotQuote(string(port)))
+		}
+	}
+
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
+
+func (wr *WorkflowSpec) ExportDOT(w io.Writer) error {
+	return wr.graph.ExportDOT(w)
+}
+
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", "")
+
+// dotQuote returns s as a quoted DOT string.
+func dotQuote(s string) string {
+	return `"` + dotEscaper.Replace(s) + `"`
+}
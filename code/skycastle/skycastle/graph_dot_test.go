@@ -0,0 +1,59 @@
+package skycastle
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestExportDOT(t *testing.T) {
+	b := NewWorkflowGraphBuilder()
+
+	src := b.AddFileArtifact(WithArtifactPath("main.go"))
+	tools := b.AddDirectoryArtifact(WithArtifactDescription(`the "tools"`))
+	build := b.AddAction("go build", WithActionDescription("build"))
+	if err := b.AddInput(build, Port("SRC"), src); err != nil {
+		t.Fatalf("AddInput: %v", err)
+	}
+	if err := b.AddDep(build, tools); err != nil {
+		t.Fatalf("AddDep: %v", err)
+	}
+	bin, err := b.AddOutputFile(build, Port("BIN"))
+	if err != nil {
+		t.Fatalf("AddOutputFile: %v", err)
+	}
+
+	g := b.Cospan.Apex
+	var buf bytes.Buffer
+	if err := g.ExportDOT(&buf); err != nil {
+		t.Fatalf("ExportDOT: %v", err)
+	}
+	out := buf.String()
+
+	id := func(u Unique) string { return `"` + u.String() + `"` }
+	action := id(Unique(b.ActionHandles[build]))
+	for _, want := range []string{
+		"digraph workflow {\n",
+		id(Unique(b.ArtifactHandles[src])) + ` [shape=ellipse, label="main.go\nfile"];`,
+		id(Unique(b.ArtifactHandles[tools])) + ` [shape=ellipse, label="the \"tools\"\ndirectory"];`,
+		action + ` [shape=box, label="build"];`,
+		id(Unique(b.ArtifactHandles[src])) + " -> " + action + ` [label="SRC"];`,
+		id(Unique(b.ArtifactHandles[tools])) + " -> " + action + " [style=dashed];",
+		action + " -> " + id(Unique(b.ArtifactHandles[bin])) + ` [label="BIN"];`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected output to contain %s, got:\n%s", want, out)
+		}
+	}
+	if !strings.HasSuffix(out, "}\n") {
+		t.Fatalf("expected the graph to be closed, got:\n%s", out)
+	}
+
+	var again bytes.Buffer
+	if err := g.ExportDOT(&again); err != nil {
+		t.Fatalf("ExportDOT: %v", err)
+	}
+	if again.String() != out {
+		t.Fatalf("expected the same output every time")
+	}
+}
@@ -0,0 +1,263 @@
+package skycastle
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// The JSON export is a single document holding the whole graph, for backups
+// and test fixtures. Unlike the JSON Lines export it is meant to be read and
+// written by hand, so its schema is fixed and versioned:
+//
+//	{
+//	  "version": 1,
+//	  "artifacts": [
+//	    {"id": "<id>",
+//	     "kind": "file" | "directory" | "symlink" | "archive" | "image",
+//	     "description": "...", "path": "...", "format": "...",
+//	     "link_target": "...", "archive_format": "tar" | "zip",
+//	     "compression": "...", "image_ref": "..."}
+//	  ],
+//	  "actions": [
+//	    {"id": "<id>", "command": "...", "description": "...",
+//	     "policy": {"max_duration_seconds": 0, "max_retries": 0},
+//	     "no_cache": false, "env": {"NAME": "value"},
+//	     "working_dir": "...", "annotations": {"key": "value"},
+//	     "inputs": {"PORT": "<artifact id>"}, "input_order": ["PORT"],
+//	     "outputs": {"PORT": "<artifact id>"}, "deps": ["<artifact id>"]}
+//	  ]
+//	}
+//
+// Ids are the base64 form of Unique. Only "id" and "kind" are required on
+// artifacts, along with the metadata of their kind, and only "id" on
+// actions. Artifacts and actions are written in id order and map keys in
+// port order, so the same graph always exports to the same bytes.
+
+const graphJSONVersion = 1
+
+var ErrInvalidGraphJSON = errors.New("invalid JSON graph")
+
+type graphJSON struct {
+	Version   int            `json:"version"`
+	Artifacts []artifactJSON `json:"artifacts"`
+	Actions   []actionJSON   `json:"actions"`
+}
+
+type artifactJSON struct {
+	Id          string `json:"id"`
+	Kind        string `json:"kind"`
+	Description string `json:"description,omitempty"`
+	Path        string `json:"path,omitempty"`
+	Format      string `json:"format,omitempty"`
+
+	LinkTarget    string `json:"link_target,omitempty"`
+	ArchiveFormat string `json:"archive_format,omitempty"`
+	Compression   string `json:"compression,omitempty"`
+	ImageRef      string `json:"image_ref,omitempty"`
+}
+
+type actionJSON struct {
+	Id          string            `json:"id"`
+	Command     string            `json:"command,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Policy      *policyJSON       `json:"policy,omitempty"`
+	NoCache     bool              `json:"no_cache,omitempty"`
+	Env         map[string]string `json:"env,omitempty"`
+	WorkingDir  string            `json:"working_dir,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Inputs      map[Port]string   `json:"inputs,omitempty"`
+	InputOrder  []Port            `json:"input_order,omitempty"`
+	Outputs     map[Port]string   `json:"outputs,omitempty"`
+	Deps        []string          `json:"deps,omitempty"`
+}
+
+type policyJSON struct {
+	MaxDurationSeconds int `json:"max_duration_seconds"`
+	MaxRetries         int `json:"max_retries"`
+}
+
+// ExportJSON writes the whole graph to w as one JSON document.
+func (g *WorkflowGraph) ExportJSON(w io.Writer) error {
+	doc := graphJSON{
+		Version:   graphJSONVersion,
+		Artifacts: []artifactJSON{},
+		Actions:   []actionJSON{},
+	}
+
+	nodeIds := slices.SortedFunc(maps.Keys(g.Nodes), func(a, b NodeId) int {
+		return strings.Compare(Unique(a).String(), Unique(b).String())
+	})
+	for _, id := range nodeIds {
+		node := g.Nodes[id]
+		if !node.Kind.Valid() {
+			return fmt.Errorf("%w: %d", ErrInvalidArtifactKind, node.Kind)
+		}
+		doc.Artifacts = append(doc.Artifacts, artifactJSON{
+			Id:          Unique(id).String(),
+			Kind:        node.Kind.String(),
+			Description: node.Description,
+			Path:        node.Path,
+			Format:      node.Format,
+
+			LinkTarget:    node.LinkTarget,
+			ArchiveFormat: node.ArchiveFormat,
+			Compression:   node.Compression,
+			ImageRef:      node.ImageRef,
+		})
+	}
+
+	for _, id := range sortedEdgeIds(g) {
+		edge := g.Edges[id]
+		action := actionJSON{
+			Id:          Unique(id).String(),
+			Command:     edge.Command,
+			Description: edge.Description,
+			Policy: &policyJSON{
+				MaxDurationSeconds: edge.Policy.MaxDurationSeconds,
+				MaxRetries:         edge.Policy.MaxRetries,
+			},
+			NoCache:     edge.NoCache,
+			Env:         edge.Env,
+			WorkingDir:  edge.WorkingDir,
+			Annotations: edge.Annotations,
+			Inputs:      make(map[Port]string, len(edge.Inputs)),
+			InputOrder:  edge.InputOrder,
+			Outputs:     make(map[Port]string, len(edge.Outputs)),
+		}
+		for port, artifact := range edge.Inputs {
+			action.Inputs[port] = Unique(artifact).String()
+		}
+		for port, artifact := range edge.Outputs {
+			action.Outputs[port] = Unique(artifact).String()
+		}
+		for _, dep := range edge.Deps {
+			action.Deps = append(action.Deps, Unique(dep).String())
+		}
+		doc.Actions = append(doc.Actions, action)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+func (wr *WorkflowSpec) ExportJSON(w io.Writer) error {
+	return wr.graph.ExportJSON(w)
+}
+
+// ImportJSON reads a graph written by ExportJSON. Unknown fields and
+// versions are rejected, and the imported graph must pass Check, so every
+// reference resolves, no artifact has two producers, and there are no cycles.
+func ImportJSON(r io.Reader) (*WorkflowGraph, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+
+	var doc graphJSON
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidGraphJSON, err)
+	}
+	if doc.Version != graphJSONVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidGraphJSON, doc.Version)
+	}
+
+	g := NewWorkflowGraph()
+	for _, record := range doc.Artifacts {
+		id, err := uniqueFromString(record.Id)
+		if err != nil {
+			return nil, fmt.Errorf("%w: artifact %q: %w", ErrInvalidGraphJSON, record.Id, err)
+		}
+		if _, ok := g.Nodes[NodeId(id)]; ok {
+			return nil, fmt.Errorf("%w: artifact %s appears more than once", ErrInvalidGraphJSON, record.Id)
+		}
+		kind, err := parseArtifactKind(record.Kind)
+		if err != nil {
+			return nil, fmt.Errorf("%w: artifact %s: %w", ErrInvalidGraphJSON, record.Id, err)
+		}
+		g.Nodes[NodeId(id)] = WorkflowGraphNode{
+			Id:          NodeId(id),
+			Description: record.Description,
+			Kind:        kind,
+			Path:        record.Path,
+			Format:      record.Format,
+
+			LinkTarget:    record.LinkTarget,
+			ArchiveFormat: record.ArchiveFormat,
+			Compression:   record.Compression,
+			ImageRef:      record.ImageRef,
+		}
+	}
+
+	for _, record := range doc.Actions {
+		id, err := uniqueFromString(record.Id)
+		if err != nil {
+			return nil, fmt.Errorf("%w: action %q: %w", ErrInvalidGraphJSON, record.Id, err)
+		}
+		if _, ok := g.Edges[EdgeId(id)]; ok {
+			return nil, fmt.Errorf("%w: action %s appears more than once", ErrInvalidGraphJSON, record.Id)
+		}
+
+		edge := WorkflowGraphEdge{
+			Id:          EdgeId(id),
+			Description: record.Description,
+			Command:     record.Command,
+			Policy:      DefaultPolicy(),
+			NoCache:     record.NoCache,
+			Env:         make(map[string]string),
+			Inputs:      make(map[Port]NodeId),
+			Outputs:     make(map[Port]NodeId),
+			InputOrder:  record.InputOrder,
+			WorkingDir:  record.WorkingDir,
+			Annotations: make(map[string]string),
+		}
+		if record.Policy != nil {
+			edge.Policy = Policy{
+				MaxDurationSeconds: record.Policy.MaxDurationSeconds,
+				MaxRetries:         record.Policy.MaxRetries,
+			}
+		}
+		maps.Copy(edge.Env, record.Env)
+		maps.Copy(edge.Annotations, record.Annotations)
+
+		resolve := func(s string) (NodeId, error) {
+			artifact, err := uniqueFromString(s)
+			if err != nil {
+				return NodeId{}, err
+			}
+			if _, ok := g.Nodes[NodeId(artifact)]; !ok {
+				return NodeId{}, fmt.Errorf("%w: %s", ErrInvalidArtifactHandle, s)
+			}
+			return NodeId(artifact), nil
+		}
+		for _, port := range slices.Sorted(maps.Keys(record.Inputs)) {
+			s := record.Inputs[port]
+			if edge.Inputs[port], err = resolve(s); err != nil {
+				return nil, fmt.Errorf("%w: action %s: input %s: %w", ErrInvalidGraphJSON, record.Id, port, err)
+			}
+		}
+		for _, port := range slices.Sorted(maps.Keys(record.Outputs)) {
+			s := record.Outputs[port]
+			if edge.Outputs[port], err = resolve(s); err != nil {
+				return nil, fmt.Errorf("%w: action %s: output %s: %w", ErrInvalidGraphJSON, record.Id, port, err)
+			}
+		}
+		for _, s := range record.Deps {
+			dep, err := resolve(s)
+			if err != nil {
+				return nil, fmt.Errorf("%w: action %s: dep: %w", ErrInvalidGraphJSON, record.Id, err)
+			}
+			edge.Deps = append(edge.Deps, dep)
+		}
+
+		g.Edges[EdgeId(id)] = edge
+	}
+
+	if err := g.Check(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidGraphJSON, err)
+	}
+	return g, nil
+}
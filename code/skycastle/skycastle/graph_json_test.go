@@ -0,0 +1,114 @@
+package skycastle
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJSON_RoundTrip(t *testing.T) {
+	b := NewWorkflowGraphBuilder()
+
+	src := b.AddFileArtifact(WithArtifactDescription("src"), WithArtifactPath("main.go"), WithArtifactFormat("go"))
+	cfg := b.AddFileArtifact(WithArtifactPath("config.yaml"))
+	makefile := b.AddFileArtifact(WithArtifactPath("Makefile"))
+
+	build := b.AddAction("make",
+		WithActionDescription("build"),
+		WithEnvVar("GOOS", "linux"),
+		WithPolicyOptions(WithMaxRetries(2)),
+	)
+	if err := b.AddInputs(build, map[Port]ArtifactHandle{"SRC": src, "CFG": cfg}); err != nil {
+		t.Fatalf("AddInputs: %v", err)
+	}
+	if err := b.SetInputOrder(build, []Port{"SRC", "CFG"}); err != nil {
+		t.Fatalf("SetInputOrder: %v", err)
+	}
+	if err := b.AddDep(build, makefile); err != nil {
+		t.Fatalf("AddDep: %v", err)
+	}
+	bin, err := b.AddOutputDirectory(build, Port("BIN"))
+	if err != nil {
+		t.Fatalf("AddOutputDirectory: %v", err)
+	}
+
+	deploy := b.AddAction("./deploy.sh", WithNoCache(true))
+	if err := b.AddInput(deploy, Port("BIN"), bin); err != nil {
+		t.Fatalf("AddInput: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := b.Cospan.Apex.ExportJSON(&buf); err != nil {
+		t.Fatalf("ExportJSON: %v", err)
+	}
+	exported := buf.String()
+
+	imported, err := ImportJSON(&buf)
+	if err != nil {
+		t.Fatalf("ImportJSON: %v", err)
+	}
+	if !reflect.DeepEqual(imported, b.Cospan.Apex) {
+		t.Fatalf("round trip mismatch:\n got %+v\nwant %+v", imported, b.Cospan.Apex)
+	}
+
+	var again bytes.Buffer
+	if err := imported.ExportJSON(&again); err != nil {
+		t.Fatalf("ExportJSON: %v", err)
+	}
+	if again.String() != exported {
+		t.Fatalf("expected a re-export to be identical:\n got %s\nwant %s", again.String(), exported)
+	}
+}
+
+func TestJSON_RejectsInvalidGraphs(t *testing.T) {
+	file := NewUnique().String()
+	first := NewUnique().String()
+	second := NewUnique().String()
+	absent := NewUnique().String()
+
+	tests := []struct {
+		name string
+		doc  string
+		want error
+	}{
+		{
+			name: "unsupported version",
+			doc:  `{"version": 2, "artifacts": [], "actions": []}`,
+		},
+		{
+			name: "unknown field",
+			doc:  `{"version": 1, "artifacts": [], "actions": [], "extra": true}`,
+		},
+		{
+			name: "dangling input",
+			doc:  `{"version": 1, "artifacts": [], "actions": [{"id": "` + first + `", "inputs": {"IN": "` + absent + `"}}]}`,
+			want: ErrInvalidArtifactHandle,
+		},
+		{
+			name: "duplicate artifact",
+			doc: `{"version": 1, "artifacts": [{"id": "` + file + `", "kind": "file"}, {"id": "` + file + `", "kind": "file"}],
+				"actions": []}`,
+		},
+		{
+			name: "two producers",
+			doc: `{"version": 1, "artifacts": [{"id": "` + file + `", "kind": "file"}], "actions": [
+				{"id": "` + first + `", "outputs": {"OUT": "` + file + `"}},
+				{"id": "` + second + `", "outputs": {"OUT": "` + file + `"}}]}`,
+			want: ErrInconsistentGraph,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ImportJSON(strings.NewReader(tt.doc))
+			if !errors.Is(err, ErrInvalidGraphJSON) {
+				t.Fatalf("expected ErrInvalidGraphJSON, got %v", err)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
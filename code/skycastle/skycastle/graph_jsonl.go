@@ -0,0 +1,341 @@
+package skycastle
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	"go.starlark.net/starlark"
+)
+
+// The JSON Lines export writes one type-tagged object per line: every
+// artifact first, then each action followed by the edges wiring it to its
+// inputs, outputs and deps. Lines are written as the graph is walked, so the
+// export never builds the whole document in memory. Records share the field
+// names of the JSON export.
+
+const (
+	jsonlTypeArtifact = "artifact"
+	jsonlTypeAction   = "action"
+	jsonlTypeEdge     = "edge"
+)
+
+const (
+	jsonlDirectionInput  = "input"
+	jsonlDirectionOutput = "output"
+	jsonlDirectionDep    = "dep"
+)
+
+var ErrInvalidJSONL = errors.New("invalid JSON Lines graph")
+
+type jsonlRecord struct {
+	Type string `json:"type"`
+
+	// Artifacts and actions.
+	Id          string `json:"id,omitempty"`
+	Description string `json:"description,omitempty"`
+
+	// Artifacts.
+	Kind   string `json:"kind,omitempty"`
+	Path   string `json:"path,omitempty"`
+	Format string `json:"format,omitempty"`
+
+	LinkTarget    string `json:"link_target,omitempty"`
+	ArchiveFormat string `json:"archive_format,omitempty"`
+	Compression   string `json:"compression,omitempty"`
+	ImageRef      string `json:"image_ref,omitempty"`
+
+	// Actions.
+	Command string            `json:"command,omitempty"`
+	Policy  *policyJSON       `json:"policy,omitempty"`
+	NoCache bool              `json:"no_cache,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+
+	WorkingDir  string            `json:"working_dir,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// Edges.
+	Action    string `json:"action,omitempty"`
+	Artifact  string `json:"artifact,omitempty"`
+	Direction string `json:"direction,omitempty"`
+	Port      Port   `json:"port,omitempty"`
+
+	// Ordinal is the 1-based position of an input in the action's declared
+	// input order, or zero when inputs are unordered.
+	Ordinal int `json:"ordinal,omitempty"`
+}
+
+// ExportJSONL streams the graph to w as JSON Lines.
+func (g *WorkflowGraph) ExportJSONL(w io.Writer) error {
+	enc := json.NewEncoder(w)
+
+	nodeIds := slices.SortedFunc(maps.Keys(g.Nodes), func(a, b NodeId) int {
+		return strings.Compare(Unique(a).String(), Unique(b).String())
+	})
+	for _, id := range nodeIds {
+		node := g.Nodes[id]
+		if !node.Kind.Valid() {
+			return fmt.Errorf("%w: %d", ErrInvalidArtifactKind, node.Kind)
+		}
+		if err := enc.Encode(jsonlRecord{
+			Type:        jsonlTypeArtifact,
+			Id:          Unique(id).String(),
+			Description: node.Description,
+			Kind:        node.Kind.String(),
+			Path:        node.Path,
+			Format:      node.Format,
+
+			LinkTarget:    node.LinkTarget,
+			ArchiveFormat: node.ArchiveFormat,
+			Compression:   node.Compression,
+			ImageRef:      node.ImageRef,
+		}); err != nil {
+			return err
+		}
+	}
+
+	edgeIds := slices.SortedFunc(maps.Keys(g.Edges), func(a, b EdgeId) int {
+		return strings.Compare(Unique(a).String(), Unique(b).String())
+	})
+	for _, id := range edgeIds {
+		edge := g.Edges[id]
+		action := Unique(id).String()
+
+		if err := enc.Encode(jsonlRecord{
+			Type:        jsonlTypeAction,
+			Id:          action,
+			Description: edge.Description,
+			Command:     edge.Command,
+			Policy: &policyJSON{
+				MaxDurationSeconds: edge.Policy.MaxDurationSeconds,
+				MaxRetries:         edge.Policy.MaxRetries,
+			},
+			NoCache:     edge.NoCache,
+			Env:         edge.Env,
+			WorkingDir:  edge.WorkingDir,
+			Annotations: edge.Annotations,
+		}); err != nil {
+			return err
+		}
+
+		wire := func(direction string, port Port, artifact NodeId, ordinal int) error {
+			return enc.Encode(jsonlRecord{
+				Type:      jsonlTypeEdge,
+				Action:    action,
+				Artifact:  Unique(artifact).String(),
+				Direction: direction,
+				Port:      port,
+				Ordinal:   ordinal,
+			})
+		}
+
+		for _, port := range slices.Sorted(maps.Keys(edge.Inputs)) {
+			ordinal := slices.Index(edge.InputOrder, port) + 1
+			if err := wire(jsonlDirectionInput, port, edge.Inputs[port], ordinal); err != nil {
+				return err
+			}
+		}
+		for _, port := range slices.Sorted(maps.Keys(edge.Outputs)) {
+			if err := wire(jsonlDirectionOutput, port, edge.Outputs[port], 0); err != nil {
+				return err
+			}
+		}
+		for _, dep := range edge.Deps {
+			if err := wire(jsonlDirectionDep, "", dep, 0); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (wr *WorkflowSpec) ExportJSONL(w io.Writer) error {
+	return wr.graph.ExportJSONL(w)
+}
+
+// ImportJSONL reads a graph written by ExportJSONL, one line at a time.
+func ImportJSONL(r io.Reader) (*WorkflowGraph, error) {
+	g := NewWorkflowGraph()
+
+	// Input edges are written in port order, not declared order, so ordinals
+	// are collected and turned into each action's input order at the end.
+	ordinals := make(map[EdgeId]map[Port]int)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+
+		var record jsonlRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidJSONL, line, err)
+		}
+		if err := g.importJSONLRecord(record, ordinals); err != nil {
+			return nil, fmt.Errorf("%w: line %d: %w", ErrInvalidJSONL, line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, id := range sortedEdgeIds(g) {
+		ports, ok := ordinals[id]
+		if !ok {
+			continue
+		}
+
+		order := make([]Port, len(ports))
+		for port, ordinal := range ports {
+			if ordinal > len(order) || order[ordinal-1] != "" {
+				return nil, fmt.Errorf("%w: action %s: input ordinals are not 1 to %d", ErrInvalidJSONL, Unique(id).String(), len(order))
+			}
+			order[ordinal-1] = port
+		}
+
+		edge := g.Edges[id]
+		edge.InputOrder = order
+		g.Edges[id] = edge
+	}
+
+	return g, nil
+}
+
+func (g *WorkflowGraph) importJSONLRecord(record jsonlRecord, ordinals map[EdgeId]map[Port]int) error {
+	switch record.Type {
+	case jsonlTypeArtifact:
+		id, err := uniqueFromString(record.Id)
+		if err != nil {
+			return err
+		}
+		if _, ok := g.Nodes[NodeId(id)]; ok {
+			return fmt.Errorf("artifact %s appears more than once", record.Id)
+		}
+		kind, err := parseArtifactKind(record.Kind)
+		if err != nil {
+			return err
+		}
+		g.Nodes[NodeId(id)] = WorkflowGraphNode{
+			Id:          NodeId(id),
+			Description: record.Description,
+			Kind:        kind,
+			Path:        record.Path,
+			Format:      record.Format,
+
+			LinkTarget:    record.LinkTarget,
+			ArchiveFormat: record.ArchiveFormat,
+			Compression:   record.Compression,
+			ImageRef:      record.ImageRef,
+		}
+
+	case jsonlTypeAction:
+		id, err := uniqueFromString(record.Id)
+		if err != nil {
+			return err
+		}
+		// A repeated action line would replace the action and drop the
+		// edges read so far, so it is reported rather than applied.
+		if _, ok := g.Edges[EdgeId(id)]; ok {
+			return fmt.Errorf("action %s appears more than once", record.Id)
+		}
+		edge := WorkflowGraphEdge{
+			Id:          EdgeId(id),
+			Description: record.Description,
+			Command:     record.Command,
+			Policy:      DefaultPolicy(),
+			NoCache:     record.NoCache,
+			Env:         make(map[string]string),
+			Inputs:      make(map[Port]NodeId),
+			Outputs:     make(map[Port]NodeId),
+			WorkingDir:  record.WorkingDir,
+			Annotations: make(map[string]string),
+		}
+		if record.Policy != nil {
+			edge.Policy = Policy{
+				MaxDurationSeconds: record.Policy.MaxDurationSeconds,
+				MaxRetries:         record.Policy.MaxRetries,
+			}
+		}
+		maps.Copy(edge.Env, record.Env)
+		maps.Copy(edge.Annotations, record.Annotations)
+		g.Edges[EdgeId(id)] = edge
+
+	case jsonlTypeEdge:
+		actionId, err := uniqueFromString(record.Action)
+		if err != nil {
+			return err
+		}
+		edge, ok := g.Edges[EdgeId(actionId)]
+		if !ok {
+			return ErrInvalidActionHandle
+		}
+		artifactId, err := uniqueFromString(record.Artifact)
+		if err != nil {
+			return err
+		}
+		if _, ok := g.Nodes[NodeId(artifactId)]; !ok {
+			return ErrInvalidArtifactHandle
+		}
+
+		if record.Ordinal != 0 && record.Direction != jsonlDirectionInput {
+			return fmt.Errorf("ordinal on %s edge", record.Direction)
+		}
+
+		switch record.Direction {
+		case jsonlDirectionInput:
+			if record.Ordinal < 0 {
+				return fmt.Errorf("negative input ordinal %d", record.Ordinal)
+			}
+			edge.Inputs[record.Port] = NodeId(artifactId)
+			if record.Ordinal > 0 {
+				if ordinals[EdgeId(actionId)] == nil {
+					ordinals[EdgeId(actionId)] = make(map[Port]int)
+				}
+				ordinals[EdgeId(actionId)][record.Port] = record.Ordinal
+			}
+		case jsonlDirectionOutput:
+			edge.Outputs[record.Port] = NodeId(artifactId)
+		case jsonlDirectionDep:
+			edge.Deps = append(edge.Deps, NodeId(artifactId))
+		default:
+			return fmt.Errorf("unknown edge direction %q", record.Direction)
+		}
+		g.Edges[EdgeId(actionId)] = edge
+
+	default:
+		return fmt.Errorf("unknown record type %q", record.Type)
+	}
+
+	return nil
+}
+
+func uniqueFromString(s string) (Unique, error) {
+	return UniqueFromStarlarkString(starlark.String(s))
+}
+
+func parseArtifactKind(s string) (ArtifactKind, error) {
+	switch s {
+	case "file":
+		return ArtifactKindFile, nil
+	case "directory":
+		return ArtifactKindDirectory, nil
+	case "symlink":
+		return ArtifactKindSymlink, nil
+	case "archive":
+		return ArtifactKindArchive, nil
+	case "image":
+		return ArtifactKindImage, nil
+	default:
+		return 0, fmt.Errorf("%w: %q", ErrInvalidArtifactKind, s)
+	}
+}
@@ -0,0 +1,148 @@
+package skycastle
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestJSONL_RoundTrip(t *testing.T) {
+	b := NewWorkflowGraphBuilder()
+
+	src := b.AddFileArtifact(WithArtifactDescription("src"), WithArtifactPath("main.go"), WithArtifactFormat("go"))
+	makefile := b.AddFileArtifact(WithArtifactPath("Makefile"))
+
+	build := b.AddAction("make",
+		WithActionDescription("build"),
+		WithEnvVar("GOOS", "linux"),
+		WithPolicyOptions(WithMaxRetries(2)),
+	)
+	if err := b.AddInput(build, Port("SRC"), src); err != nil {
+		t.Fatalf("AddInput: %v", err)
+	}
+	if err := b.AddDep(build, makefile); err != nil {
+		t.Fatalf("AddDep: %v", err)
+	}
+	bin, err := b.AddOutputDirectory(build, Port("BIN"))
+	if err != nil {
+		t.Fatalf("AddOutputDirectory: %v", err)
+	}
+
+	deploy := b.AddAction("./deploy.sh", WithNoCache(true))
+	if err := b.AddInput(deploy, Port("BIN"), bin); err != nil {
+		t.Fatalf("AddInput: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := b.Cospan.Apex.ExportJSONL(&buf); err != nil {
+		t.Fatalf("ExportJSONL: %v", err)
+	}
+
+	// 3 artifacts, 2 actions, 4 edges.
+	if lines := strings.Count(buf.String(), "\n"); lines != 9 {
+		t.Fatalf("expected 9 lines, got %d:\n%s", lines, buf.String())
+	}
+
+	// Policies use the same field names as the JSON export.
+	if !strings.Contains(buf.String(), `"policy":{"max_duration_seconds":0,"max_retries":2}`) {
+		t.Fatalf("expected a snake_case policy in the export:\n%s", buf.String())
+	}
+
+	imported, err := ImportJSONL(&buf)
+	if err != nil {
+		t.Fatalf("ImportJSONL: %v", err)
+	}
+
+	if !reflect.DeepEqual(imported, b.Cospan.Apex) {
+		t.Fatalf("round trip mismatch:\n got %+v\nwant %+v", imported, b.Cospan.Apex)
+	}
+}
+
+func TestJSONL_RejectsDanglingEdge(t *testing.T) {
+	b := NewWorkflowGraphBuilder()
+	act := b.AddAction("true")
+	if _, err := b.AddOutputFile(act, Port("OUT")); err != nil {
+		t.Fatalf("AddOutputFile: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := b.Cospan.Apex.ExportJSONL(&buf); err != nil {
+		t.Fatalf("ExportJSONL: %v", err)
+	}
+
+	// Drop the artifact line so the output edge refers to nothing.
+	_, rest, _ := strings.Cut(buf.String(), "\n")
+
+	_, err := ImportJSONL(strings.NewReader(rest))
+	if !errors.Is(err, ErrInvalidJSONL) || !errors.Is(err, ErrInvalidArtifactHandle) {
+		t.Fatalf("expected ErrInvalidJSONL wrapping ErrInvalidArtifactHandle, got %v", err)
+	}
+}
+
+func TestJSONL_RejectsRepeatedRecords(t *testing.T) {
+	b := NewWorkflowGraphBuilder()
+	act := b.AddAction("true")
+	if _, err := b.AddOutputFile(act, Port("OUT")); err != nil {
+		t.Fatalf("AddOutputFile: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := b.Cospan.Apex.ExportJSONL(&buf); err != nil {
+		t.Fatalf("ExportJSONL: %v", err)
+	}
+
+	// Lines are the artifact, the action and the output edge.
+	lines := strings.SplitAfter(buf.String(), "\n")
+	for name, repeated := range map[string]string{"artifact": lines[0], "action": lines[1]} {
+		_, err := ImportJSONL(strings.NewReader(buf.String() + repeated))
+		if !errors.Is(err, ErrInvalidJSONL) || !strings.Contains(err.Error(), "appears more than once") {
+			t.Fatalf("expected a repeated %s to be rejected, got %v", name, err)
+		}
+	}
+}
+
+func TestJSONL_PreservesInputOrder(t *testing.T) {
+	b := NewWorkflowGraphBuilder()
+	act := b.AddAction("cat $1 $2 $3")
+	for _, port := range []Port{"Z", "A", "M"} {
+		if err := b.AddInput(act, port, b.AddFileArtifact()); err != nil {
+			t.Fatalf("AddInput: %v", err)
+		}
+	}
+	if err := b.SetInputOrder(act, []Port{"Z", "A", "M"}); err != nil {
+		t.Fatalf("SetInputOrder: %v", err)
+	}
+	out, err := b.AddOutputFile(act, Port("OUT"))
+	if err != nil {
+		t.Fatalf("AddOutputFile: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := b.Cospan.Apex.ExportJSONL(&buf); err != nil {
+		t.Fatalf("ExportJSONL: %v", err)
+	}
+	imported, err := ImportJSONL(&buf)
+	if err != nil {
+		t.Fatalf("ImportJSONL: %v", err)
+	}
+
+	// Import keeps ids, so the builder's handles still resolve.
+	b.Cospan.Apex = imported
+	wf, err := b.Build(Target{Path: Path[Relative, File]{path: "p"}, Name: "t"}, []ArtifactHandle{out}, nil)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	for action := range wf.Actions() {
+		var ports []Port
+		for _, input := range action.OrderedInputs() {
+			ports = append(ports, input.Port)
+		}
+		if want := []Port{"Z", "A", "M"}; !slices.Equal(ports, want) {
+			t.Fatalf("expected inputs in declared order %v, got %v", want, ports)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package skycastle
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+var ErrLabelEscapesRepoRoot = errors.New("label escapes repository root")
+
+// CanonicalizeLabel maps a file or directory path onto its canonical artifact
+// label: slash-separated, cleaned, without trailing separators and relative to
+// the repository root. Paths such as "./src/foo", "src/foo" and "src/foo/"
+// therefore share one label. Absolute paths are accepted when they fall under
+// repoRoot; anything resolving outside of it is rejected.
+func CanonicalizeLabel(repoRoot, p string) (string, error) {
+	if p == "" {
+		return "", fmt.Errorf("empty label")
+	}
+
+	cleaned := path.Clean(strings.ReplaceAll(p, "\\", "/"))
+
+	if path.IsAbs(cleaned) {
+		root := path.Clean(strings.ReplaceAll(repoRoot, "\\", "/"))
+		switch {
+		case cleaned == root:
+			cleaned = "."
+		case strings.HasPrefix(cleaned, strings.TrimSuffix(root, "/")+"/"):
+			cleaned = strings.TrimPrefix(cleaned, strings.TrimSuffix(root, "/")+"/")
+		default:
+			return "", fmt.Errorf("%w: %s", ErrLabelEscapesRepoRoot, p)
+		}
+	}
+
+	if cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("%w: %s", ErrLabelEscapesRepoRoot, p)
+	}
+
+	return cleaned, nil
+}
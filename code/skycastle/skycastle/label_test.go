@@ -0,0 +1,65 @@
+package skycastle
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCanonicalizeLabel_Equivalences(t *testing.T) {
+	cases := []string{
+		"src/foo",
+		"./src/foo",
+		"src/foo/",
+		"src//foo",
+		"src/./foo",
+		"src/bar/../foo",
+		"src\\foo",
+		"/repo/src/foo",
+		"/repo/src/foo/",
+	}
+
+	for _, c := range cases {
+		got, err := CanonicalizeLabel("/repo", c)
+		if err != nil {
+			t.Fatalf("CanonicalizeLabel(%q): unexpected error: %v", c, err)
+		}
+		if got != "src/foo" {
+			t.Errorf("CanonicalizeLabel(%q) = %q, want %q", c, got, "src/foo")
+		}
+	}
+}
+
+func TestCanonicalizeLabel_RepoRoot(t *testing.T) {
+	for _, c := range []string{".", "./", "/repo", "/repo/"} {
+		got, err := CanonicalizeLabel("/repo/", c)
+		if err != nil {
+			t.Fatalf("CanonicalizeLabel(%q): unexpected error: %v", c, err)
+		}
+		if got != "." {
+			t.Errorf("CanonicalizeLabel(%q) = %q, want %q", c, got, ".")
+		}
+	}
+}
+
+func TestCanonicalizeLabel_RejectsEscapes(t *testing.T) {
+	cases := []string{
+		"..",
+		"../foo",
+		"src/../../foo",
+		"/other/foo",
+		"/repository/foo",
+	}
+
+	for _, c := range cases {
+		_, err := CanonicalizeLabel("/repo", c)
+		if !errors.Is(err, ErrLabelEscapesRepoRoot) {
+			t.Errorf("CanonicalizeLabel(%q): expected ErrLabelEscapesRepoRoot, got %v", c, err)
+		}
+	}
+}
+
+func TestCanonicalizeLabel_RejectsEmpty(t *testing.T) {
+	if _, err := CanonicalizeLabel("/repo", ""); err == nil {
+		t.Fatalf("expected error for empty label")
+	}
+}
@@ -0,0 +1,76 @@
+package skycastle
+
+import (
+	"cmp"
+	"slices"
+)
+
+// ExecutionLevels groups the actions needed to produce a workflow's goals by
+// the earliest point they can run: level 0 holds actions that consume only
+// source artifacts, and each later level holds actions whose inputs and deps
+// are all produced by earlier levels. Actions within a level can run in
+// parallel.
+func ExecutionLevels(wf Workflow) [][]Action {
+	levelOf := make(map[Action]int)
+
+	var visit func(action Action) int
+	visit = func(action Action) int {
+		if level, ok := levelOf[action]; ok {
+			return level
+		}
+
+		level := 0
+		for _, artifact := range actionDependencies(action) {
+			if _, producer := artifact.Producer(); producer != nil {
+				level = max(level, visit(producer)+1)
+			}
+		}
+
+		levelOf[action] = level
+		return level
+	}
+
+	for goal := range wf.Goals() {
+		if _, producer := goal.Producer(); producer != nil {
+			visit(producer)
+		}
+	}
+
+	levels := [][]Action{}
+	for action, level := range levelOf {
+		for len(levels) <= level {
+			levels = append(levels, nil)
+		}
+		levels[level] = append(levels[level], action)
+	}
+
+	for _, level := range levels {
+		slices.SortFunc(level, func(a, b Action) int {
+			return cmp.Or(
+				cmp.Compare(a.Description(), b.Description()),
+				cmp.Compare(a.Command(), b.Command()),
+			)
+		})
+	}
+
+	return levels
+}
+
+// MaxParallelWidth returns the index and size of the widest execution level,
+// the most actions that can run at once. The earliest level wins a tie.
+func MaxParallelWidth(levels [][]Action) (level int, width int) {
+	for i, actions := range levels {
+		if len(actions) > width {
+			level, width = i, len(actions)
+		}
+	}
+	return level, width
+}
+
+func actionDependencies(action Action) []Artifact {
+	var artifacts []Artifact
+	for _, input := range action.OrderedInputs() {
+		artifacts = append(artifacts, input.Artifact)
+	}
+	return append(artifacts, action.Deps()...)
+}
@@ -0,0 +1,64 @@
+package skycastle
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestExecutionLevels_MaxParallelWidth(t *testing.T) {
+	b := NewWorkflowGraphBuilder()
+
+	gen := b.AddAction("gen")
+	seed, err := b.AddOutputFile(gen, Port("OUT"))
+	if err != nil {
+		t.Fatalf("AddOutputFile: %v", err)
+	}
+
+	join := b.AddAction("join")
+	for i := range 3 {
+		shard := b.AddAction(fmt.Sprintf("shard %d", i))
+		if err := b.AddInput(shard, Port("SEED"), seed); err != nil {
+			t.Fatalf("AddInput: %v", err)
+		}
+		out, err := b.AddOutputFile(shard, Port("OUT"))
+		if err != nil {
+			t.Fatalf("AddOutputFile: %v", err)
+		}
+		if err := b.AddInput(join, Port(fmt.Sprintf("SHARD_%d", i)), out); err != nil {
+			t.Fatalf("AddInput: %v", err)
+		}
+	}
+	result, err := b.AddOutputFile(join, Port("OUT"))
+	if err != nil {
+		t.Fatalf("AddOutputFile: %v", err)
+	}
+
+	// Not needed for the goal, so not part of any level.
+	unused := b.AddAction("unused")
+	if _, err := b.AddOutputFile(unused, Port("OUT")); err != nil {
+		t.Fatalf("AddOutputFile: %v", err)
+	}
+
+	res, err := b.Build(Target{Path: Path[Relative, File]{path: "p"}, Name: "t"}, []ArtifactHandle{result}, nil)
+	wf := must(t, res, err)
+
+	levels := ExecutionLevels(wf)
+
+	var got [][]string
+	for _, level := range levels {
+		var commands []string
+		for _, action := range level {
+			commands = append(commands, action.Command())
+		}
+		got = append(got, commands)
+	}
+	want := [][]string{{"gen"}, {"shard 0", "shard 1", "shard 2"}, {"join"}}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("expected levels %v, got %v", want, got)
+	}
+
+	level, width := MaxParallelWidth(levels)
+	if level != 1 || width != 3 {
+		t.Fatalf("expected width 3 at level 1, got width %d at level %d", width, level)
+	}
+}
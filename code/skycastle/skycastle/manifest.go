@@ -0,0 +1,60 @@
+package skycastle
+
+import (
+	"bufio"
+	"io"
+	"slices"
+	"strings"
+)
+
+// GoalManifest returns the sorted descriptions of a workflow's goal artifacts.
+func GoalManifest(wf Workflow) []string {
+	manifest := []string{}
+	for goal := range wf.Goals() {
+		manifest = append(manifest, goal.Description())
+	}
+	slices.Sort(manifest)
+	return manifest
+}
+
+// ReadManifest reads an expected goal manifest, one artifact description per
+// line. Blank lines and lines starting with '#' are ignored.
+func ReadManifest(r io.Reader) ([]string, error) {
+	manifest := []string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		manifest = append(manifest, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	slices.Sort(manifest)
+	return manifest, nil
+}
+
+// DiffManifest compares two sorted manifests, returning the entries missing
+// from actual and the entries in actual that were not expected.
+func DiffManifest(expected, actual []string) (missing, unexpected []string) {
+	missing, unexpected = []string{}, []string{}
+	i, j := 0, 0
+	for i < len(expected) && j < len(actual) {
+		switch {
+		case expected[i] == actual[j]:
+			i++
+			j++
+		case expected[i] < actual[j]:
+			missing = append(missing, expected[i])
+			i++
+		default:
+			unexpected = append(unexpected, actual[j])
+			j++
+		}
+	}
+	missing = append(missing, expected[i:]...)
+	unexpected = append(unexpected, actual[j:]...)
+	return missing, unexpected
+}
@@ -0,0 +1,57 @@
+package skycastle
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func buildManifestWorkflow(t *testing.T) Workflow {
+	t.Helper()
+
+	b := NewWorkflowGraphBuilder()
+	act := b.AddAction("build")
+
+	bin, err := b.AddOutputFile(act, Port("BIN"), WithArtifactDescription("bin/server"))
+	if err != nil {
+		t.Fatalf("AddOutputFile: %v", err)
+	}
+	docs, err := b.AddOutputDirectory(act, Port("DOCS"), WithArtifactDescription("docs"))
+	if err != nil {
+		t.Fatalf("AddOutputDirectory: %v", err)
+	}
+
+	res, err := b.Build(Target{Path: Path[Relative, File]{path: "p"}, Name: "t"}, []ArtifactHandle{docs, bin}, nil)
+	return must(t, res, err)
+}
+
+func TestManifest_Matches(t *testing.T) {
+	wf := buildManifestWorkflow(t)
+
+	expected, err := ReadManifest(strings.NewReader("# goals\nbin/server\n\ndocs\n"))
+	if err != nil {
+		t.Fatalf("ReadManifest: %v", err)
+	}
+
+	missing, unexpected := DiffManifest(expected, GoalManifest(wf))
+	if len(missing) != 0 || len(unexpected) != 0 {
+		t.Fatalf("expected manifests to match, got missing=%v unexpected=%v", missing, unexpected)
+	}
+}
+
+func TestManifest_Mismatch(t *testing.T) {
+	wf := buildManifestWorkflow(t)
+
+	expected, err := ReadManifest(strings.NewReader("bin/server\nbin/client\n"))
+	if err != nil {
+		t.Fatalf("ReadManifest: %v", err)
+	}
+
+	missing, unexpected := DiffManifest(expected, GoalManifest(wf))
+	if !slices.Equal(missing, []string{"bin/client"}) {
+		t.Fatalf("expected missing [bin/client], got %v", missing)
+	}
+	if !slices.Equal(unexpected, []string{"docs"}) {
+		t.Fatalf("expected unexpected [docs], got %v", unexpected)
+	}
+}
@@ -0,0 +1,78 @@
+package skycastle
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type ProgressEvent uint8
+
+const (
+	ProgressActionAdded ProgressEvent = iota
+	ProgressArtifactAdded
+)
+
+// ProgressFunc is invoked by the workflow graph builder every time an action
+// or artifact is added. It may be called concurrently from several packages.
+type ProgressFunc func(ProgressEvent)
+
+// ProgressReporter counts builder progress events and periodically writes a
+// summary line to w.
+type ProgressReporter struct {
+	w         io.Writer
+	interval  time.Duration
+	start     time.Time
+	actions   atomic.Int64
+	artifacts atomic.Int64
+	mu        sync.Mutex
+	last      time.Time
+}
+
+func NewProgressReporter(w io.Writer, interval time.Duration) *ProgressReporter {
+	now := time.Now()
+	return &ProgressReporter{
+		w:        w,
+		interval: interval,
+		start:    now,
+		last:     now,
+	}
+}
+
+func (r *ProgressReporter) Report(event ProgressEvent) {
+	switch event {
+	case ProgressActionAdded:
+		r.actions.Add(1)
+	case ProgressArtifactAdded:
+		r.artifacts.Add(1)
+	}
+
+	if !r.mu.TryLock() {
+		return
+	}
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(r.last) < r.interval {
+		return
+	}
+	r.last = now
+	r.print(now)
+}
+
+// Done writes a final summary line.
+func (r *ProgressReporter) Done() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.print(time.Now())
+}
+
+func (r *ProgressReporter) print(now time.Time) {
+	fmt.Fprintf(r.w, "%d actions, %d artifacts (%s)\n",
+		r.actions.Load(),
+		r.artifacts.Load(),
+		now.Sub(r.start).Truncate(time.Millisecond),
+	)
+}
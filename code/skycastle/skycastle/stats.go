@@ -0,0 +1,35 @@
+package skycastle
+
+// GraphStats summarises the size of a workflow graph. Inputs, Outputs and
+// Deps count the links between actions and artifacts of each kind.
+type GraphStats struct {
+	Actions   int
+	Artifacts int
+	Inputs    int
+	Outputs   int
+	Deps      int
+}
+
+// Links returns the number of links between actions and artifacts.
+func (s GraphStats) Links() int {
+	return s.Inputs + s.Outputs + s.Deps
+}
+
+// Stats counts the actions, artifacts and links of the graph.
+func (g *WorkflowGraph) Stats() GraphStats {
+	stats := GraphStats{
+		Actions:   len(g.Edges),
+		Artifacts: len(g.Nodes),
+	}
+	for _, edge := range g.Edges {
+		stats.Inputs += len(edge.Inputs)
+		stats.Outputs += len(edge.Outputs)
+		stats.Deps += len(edge.Deps)
+	}
+	return stats
+}
+
+// Stats counts the actions, artifacts and links of the workflow's graph.
+func (wr *WorkflowSpec) Stats() GraphStats {
+	return wr.graph.Stats()
+}
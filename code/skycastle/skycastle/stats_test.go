@@ -0,0 +1,16 @@
+package skycastle
+
+import "testing"
+
+func TestStats_CountsActionsArtifactsAndLinks(t *testing.T) {
+	b, _, _ := depsTestGraph(t)
+
+	got := b.Cospan.Apex.Stats()
+	want := GraphStats{Actions: 5, Artifacts: 5, Inputs: 2, Outputs: 5, Deps: 1}
+	if got != want {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+	if got.Links() != 8 {
+		t.Fatalf("expected 8 links, got %d", got.Links())
+	}
+}
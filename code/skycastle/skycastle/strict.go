@@ -0,0 +1,90 @@
+package skycastle
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"go.starlark.net/resolve"
+	"go.starlark.net/starlark"
+)
+
+var ErrUndefinedName = errors.New("reference to undefined name")
+
+// explainUndefinedNames rewrites resolver errors for undefined names so that
+// each carries its position and, where one is close enough, a suggestion
+// from the predeclared and universal names.
+func explainUndefinedNames(err error, predeclared starlark.StringDict) error {
+	var resolveErrors resolve.ErrorList
+	if !errors.As(err, &resolveErrors) {
+		return err
+	}
+
+	candidates := slices.Concat(slices.Collect(maps.Keys(predeclared)), starlark.Universe.Keys())
+	slices.Sort(candidates)
+
+	undefined := false
+	messages := make([]string, 0, len(resolveErrors))
+	for _, resolveError := range resolveErrors {
+		msg := resolveError.Msg
+		if name, ok := strings.CutPrefix(msg, "undefined: "); ok {
+			undefined = true
+			// Drop any suggestion the resolver made itself so that the
+			// message is the same regardless of the Starlark version.
+			name, _, _ = strings.Cut(name, " ")
+			msg = "undefined: " + name
+			if suggestion := nearestName(name, candidates); suggestion != "" {
+				msg = fmt.Sprintf("undefined: %s (did you mean %s?)", name, suggestion)
+			}
+		}
+		messages = append(messages, fmt.Sprintf("%s: %s", resolveError.Pos, msg))
+	}
+
+	if !undefined {
+		return err
+	}
+	return fmt.Errorf("%w\n%s", ErrUndefinedName, strings.Join(messages, "\n"))
+}
+
+// nearestName returns the candidate closest to name by edit distance, or ""
+// when none is close enough to be a plausible typo.
+func nearestName(name string, candidates []string) string {
+	maxDistance := 1 + len(name)/4
+
+	best, bestDistance := "", maxDistance+1
+	for _, candidate := range candidates {
+		if d := editDistance(name, candidate); d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Damerau-Levenshtein (optimal string alignment)
+// distance between a and b, so transposed letters count as one edit.
+func editDistance(a, b string) int {
+	rows := make([][]int, len(a)+1)
+	for i := range rows {
+		rows[i] = make([]int, len(b)+1)
+		rows[i][0] = i
+	}
+	for j := range rows[0] {
+		rows[0][j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			rows[i][j] = min(rows[i-1][j]+1, rows[i][j-1]+1, rows[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				rows[i][j] = min(rows[i][j], rows[i-2][j-2]+1)
+			}
+		}
+	}
+	return rows[len(a)][len(b)]
+}
@@ -0,0 +1,63 @@
+package skycastle
+
+// TopoSort orders the graph's actions so that every action comes after the
+// actions producing its inputs and deps. It uses Kahn's algorithm rather than
+// recursion, so a long chain of actions cannot exhaust the stack, and keeps
+// only a count and a list of dependents per action. Actions that are ready
+// together are ordered by id, so the same graph always sorts the same way.
+//
+// A graph with a cycle has no such order; TopoSort then returns the
+// *CycleError that Validate reports.
+func (g *WorkflowGraph) TopoSort() ([]EdgeId, error) {
+	producers := g.producerIndex()
+
+	ids := sortedEdgeIds(g)
+	waiting := make(map[EdgeId]int, len(ids))
+	dependents := make(map[EdgeId][]EdgeId)
+	for _, id := range ids {
+		for _, artifact := range g.dependencies(id) {
+			if producer, ok := producers[artifact]; ok {
+				waiting[id]++
+				dependents[producer] = append(dependents[producer], id)
+			}
+		}
+	}
+
+	order := make([]EdgeId, 0, len(ids))
+	for _, id := range ids {
+		if waiting[id] == 0 {
+			order = append(order, id)
+		}
+	}
+	for i := 0; i < len(order); i++ {
+		for _, dependent := range dependents[order[i]] {
+			waiting[dependent]--
+			if waiting[dependent] == 0 {
+				order = append(order, dependent)
+			}
+		}
+	}
+
+	if len(order) < len(ids) {
+		if err := g.Validate(); err != nil {
+			return nil, err
+		}
+		return nil, ErrCycle
+	}
+	return order, nil
+}
+
+// TopoSort returns the workflow's actions in dependency order, as
+// WorkflowGraph.TopoSort does.
+func (wr *WorkflowSpec) TopoSort() ([]Action, error) {
+	ids, err := wr.graph.TopoSort()
+	if err != nil {
+		return nil, err
+	}
+
+	actions := make([]Action, len(ids))
+	for i, id := range ids {
+		actions[i] = ActionCursor{ws: wr, id: id}
+	}
+	return actions, nil
+}
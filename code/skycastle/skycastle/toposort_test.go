@@ -0,0 +1,126 @@
+package skycastle
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestTopoSort_OrdersProducersFirst(t *testing.T) {
+	b := NewWorkflowGraphBuilder()
+
+	// Wire the chain backwards so that creation order is no help.
+	join := b.AddAction("join")
+	result, err := b.AddOutputFile(join, Port("OUT"))
+	if err != nil {
+		t.Fatalf("AddOutputFile: %v", err)
+	}
+	var shards []ActionHandle
+	for i := range 3 {
+		shard := b.AddAction(fmt.Sprintf("shard %d", i))
+		out, err := b.AddOutputFile(shard, Port("OUT"))
+		if err != nil {
+			t.Fatalf("AddOutputFile: %v", err)
+		}
+		if err := b.AddInput(join, Port(fmt.Sprintf("SHARD_%d", i)), out); err != nil {
+			t.Fatalf("AddInput: %v", err)
+		}
+		shards = append(shards, shard)
+	}
+	gen := b.AddAction("gen")
+	seed, err := b.AddOutputFile(gen, Port("OUT"))
+	if err != nil {
+		t.Fatalf("AddOutputFile: %v", err)
+	}
+	for _, shard := range shards {
+		if err := b.AddDep(shard, seed); err != nil {
+			t.Fatalf("AddDep: %v", err)
+		}
+	}
+
+	res, err := b.Build(Target{Path: Path[Relative, File]{path: "p"}, Name: "t"}, []ArtifactHandle{result}, nil)
+	wf := must(t, res, err)
+
+	actions, err := wf.TopoSort()
+	if err != nil {
+		t.Fatalf("TopoSort: %v", err)
+	}
+	if len(actions) != 5 {
+		t.Fatalf("expected 5 actions, got %d", len(actions))
+	}
+
+	position := make(map[string]int)
+	for i, action := range actions {
+		position[action.Command()] = i
+	}
+	for i := range 3 {
+		shard := fmt.Sprintf("shard %d", i)
+		if position["gen"] > position[shard] || position[shard] > position["join"] {
+			t.Fatalf("expected gen, then %s, then join, got %v", shard, position)
+		}
+	}
+
+	again, err := wf.TopoSort()
+	if err != nil {
+		t.Fatalf("TopoSort: %v", err)
+	}
+	for i := range actions {
+		if again[i].Command() != actions[i].Command() {
+			t.Fatalf("expected the same order every time")
+		}
+	}
+}
+
+func TestTopoSort_RejectsCycles(t *testing.T) {
+	b := NewWorkflowGraphBuilder()
+
+	first := b.AddAction("first")
+	second := b.AddAction("second")
+	x, err := b.AddOutputFile(first, Port("OUT"))
+	if err != nil {
+		t.Fatalf("AddOutputFile: %v", err)
+	}
+	if err := b.AddInput(second, Port("IN"), x); err != nil {
+		t.Fatalf("AddInput: %v", err)
+	}
+	y, err := b.AddOutputFile(second, Port("OUT"))
+	if err != nil {
+		t.Fatalf("AddOutputFile: %v", err)
+	}
+
+	g := b.Cospan.Apex
+	g.Edges[b.ActionHandles[first]].Inputs[Port("BACK")] = b.ArtifactHandles[y]
+
+	var cycleErr *CycleError
+	if _, err := g.TopoSort(); !errors.As(err, &cycleErr) {
+		t.Fatalf("expected a *CycleError, got %v", err)
+	}
+}
+
+func TestTopoSort_LongChain(t *testing.T) {
+	b := NewWorkflowGraphBuilder()
+
+	const n = 1000
+	prev := b.AddFileArtifact()
+	for i := range n {
+		action := b.AddAction(fmt.Sprintf("step %d", i))
+		if err := b.AddInput(action, Port("IN"), prev); err != nil {
+			t.Fatalf("AddInput: %v", err)
+		}
+		out, err := b.AddOutputFile(action, Port("OUT"))
+		if err != nil {
+			t.Fatalf("AddOutputFile: %v", err)
+		}
+		prev = out
+	}
+
+	order, err := b.Cospan.Apex.TopoSort()
+	if err != nil {
+		t.Fatalf("TopoSort: %v", err)
+	}
+	for i, id := range order {
+		if got, want := b.Cospan.Apex.Edges[id].Command, fmt.Sprintf("step %d", i); got != want {
+			t.Fatalf("position %d: expected %q, got %q", i, want, got)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package skycastle
+
+import (
+	"maps"
+	"slices"
+	"strings"
+)
+
+// wiringIndex records, for each artifact of a builder's graph, the actions
+// producing and consuming it, so that checking a new link does not scan
+// every action. Links are counted per action, as an action may bind the same
+// artifact to more than one port.
+type wiringIndex struct {
+	producers map[NodeId]map[EdgeId]int
+	consumers map[NodeId]map[EdgeId]int
+}
+
+func newWiringIndex(g *WorkflowGraph) *wiringIndex {
+	x := &wiringIndex{
+		producers: make(map[NodeId]map[EdgeId]int),
+		consumers: make(map[NodeId]map[EdgeId]int),
+	}
+	for id, edge := range g.Edges {
+		for _, artifact := range edge.Outputs {
+			link(x.producers, artifact, id)
+		}
+		for _, artifact := range g.dependencies(id) {
+			link(x.consumers, artifact, id)
+		}
+	}
+	return x
+}
+
+func link(links map[NodeId]map[EdgeId]int, artifact NodeId, action EdgeId) {
+	if links[artifact] == nil {
+		links[artifact] = make(map[EdgeId]int)
+	}
+	links[artifact][action]++
+}
+
+func unlink(links map[NodeId]map[EdgeId]int, artifact NodeId, action EdgeId) {
+	links[artifact][action]--
+	if links[artifact][action] > 0 {
+		return
+	}
+	delete(links[artifact], action)
+	if len(links[artifact]) == 0 {
+		delete(links, artifact)
+	}
+}
+
+// producer returns the action producing artifact. Should the graph have been
+// edited into giving it several, the first by id is returned.
+func (x *wiringIndex) producer(artifact NodeId) (EdgeId, bool) {
+	producers := x.producers[artifact]
+	if len(producers) == 0 {
+		return EdgeId{}, false
+	}
+	return sortedActions(producers)[0], true
+}
+
+// consumersOf returns the actions consuming or depending on artifact, sorted
+// by id.
+func (x *wiringIndex) consumersOf(artifact NodeId) []EdgeId {
+	return sortedActions(x.consumers[artifact])
+}
+
+// anyConsumed reports whether any of outputs is consumed by an action.
+func (x *wiringIndex) anyConsumed(outputs map[Port]NodeId) bool {
+	for _, artifact := range outputs {
+		if len(x.consumers[artifact]) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedActions(actions map[EdgeId]int) []EdgeId {
+	return slices.SortedFunc(maps.Keys(actions), func(a, b EdgeId) int {
+		return strings.Compare(Unique(a).String(), Unique(b).String())
+	})
+}
+
+// wiring returns the builder's wiring index, building it from the graph if
+// the builder has none. Methods that restructure the graph rather than wire
+// a single link drop the index so that it is rebuilt on next use.
+func (b *WorkflowGraphBuilder) wiring() *wiringIndex {
+	if b.index == nil {
+		b.index = newWiringIndex(b.Cospan.Apex)
+	}
+	return b.index
+}
@@ -22,6 +22,12 @@ type Workflow interface {
 	Actions() iter.Seq[Action]
 	Artifacts() iter.Seq[Artifact]
 	PrettyPrint(io.Writer) error
+	ExportDOT(io.Writer) error
+	ExportJSON(io.Writer) error
+	ExportJSONL(io.Writer) error
 	Input(Port) (Artifact, bool)
 	Inputs() iter.Seq2[Port, Artifact]
+	DuplicateActions() [][]Action
+	TopoSort() ([]Action, error)
+	Stats() GraphStats
 }
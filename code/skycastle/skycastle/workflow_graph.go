@@ -9,6 +9,7 @@ import (
 	"maps"
 	"skycastle/skycastle/slice_extensions"
 	"slices"
+	"strings"
 
 	"github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
 )
@@ -30,9 +31,23 @@ type WorkflowGraphEdge struct {
 	Description string
 	Command     string
 	Policy      Policy
+	NoCache     bool
 	Env         map[string]string
 	Inputs      map[Port]NodeId
 	Outputs     map[Port]NodeId
+	Deps        []NodeId
+
+	// InputOrder is the author-declared order of input ports, for commands
+	// that refer to inputs positionally. Nil when inputs are unordered.
+	InputOrder []Port
+
+	// WorkingDir is the directory the command runs in, relative to the
+	// repository root. Empty means the repository root.
+	WorkingDir string
+
+	// Annotations are free-form metadata for tools and people. They do not
+	// affect what the action does, so they are left out of its digest.
+	Annotations map[string]string
 }
 
 type ActionOption func(*WorkflowGraphEdge)
@@ -49,12 +64,40 @@ func WithEnv(env map[string]string) ActionOption {
 	}
 }
 
+// WithWorkingDir sets the directory the command runs in, relative to the
+// repository root.
+func WithWorkingDir(dir string) ActionOption {
+	return func(n *WorkflowGraphEdge) {
+		n.WorkingDir = dir
+	}
+}
+
+func WithAnnotation(key, value string) ActionOption {
+	return func(n *WorkflowGraphEdge) {
+		n.Annotations[key] = value
+	}
+}
+
+func WithAnnotations(annotations map[string]string) ActionOption {
+	return func(n *WorkflowGraphEdge) {
+		maps.Copy(n.Annotations, annotations)
+	}
+}
+
 func WithActionDescription(description string) ActionOption {
 	return func(n *WorkflowGraphEdge) {
 		n.Description = description
 	}
 }
 
+// WithNoCache marks an action as always-run: its outputs must never be
+// reused from a previous run, even when its inputs are unchanged.
+func WithNoCache(noCache bool) ActionOption {
+	return func(n *WorkflowGraphEdge) {
+		n.NoCache = noCache
+	}
+}
+
 type PolicyOption func(*Policy)
 
 func WithMaxRetries(maximumRetries int) PolicyOption {
@@ -87,16 +130,65 @@ type WorkflowGraphNode struct {
 	Id          NodeId
 	Description string
 	Kind        ArtifactKind
+	Path        string
+	Format      string
+
+	// Kind-specific metadata. Only the fields of the artifact's kind are set;
+	// Validate checks this.
+	LinkTarget    string // symlink: the path the link points to
+	ArchiveFormat string // archive: "tar" or "zip"
+	Compression   string // archive: a tar archive's compression, if any
+	ImageRef      string // image: an OCI reference such as "registry/repo:tag"
 }
 
 type ArtifactOption func(*WorkflowGraphNode)
 
+// WithLinkTarget sets the path a symlink artifact points to.
+func WithLinkTarget(target string) ArtifactOption {
+	return func(n *WorkflowGraphNode) {
+		n.LinkTarget = target
+	}
+}
+
+// WithArchive sets an archive artifact's format and, for tar archives, its
+// compression, which may be empty.
+func WithArchive(format, compression string) ArtifactOption {
+	return func(n *WorkflowGraphNode) {
+		n.ArchiveFormat = format
+		n.Compression = compression
+	}
+}
+
+// WithImageRef sets the OCI reference of an image artifact.
+func WithImageRef(ref string) ArtifactOption {
+	return func(n *WorkflowGraphNode) {
+		n.ImageRef = ref
+	}
+}
+
 func WithArtifactDescription(description string) ArtifactOption {
 	return func(n *WorkflowGraphNode) {
 		n.Description = description
 	}
 }
 
+// WithArtifactPath records the on-disk location of a file or directory
+// artifact, relative to the repository root.
+func WithArtifactPath(path string) ArtifactOption {
+	return func(n *WorkflowGraphNode) {
+		n.Path = path
+	}
+}
+
+// WithArtifactFormat records an advisory format hint, such as "tar", for
+// tools that handle artifacts differently by format. It does not affect the
+// artifact's digest.
+func WithArtifactFormat(format string) ArtifactOption {
+	return func(n *WorkflowGraphNode) {
+		n.Format = format
+	}
+}
+
 type WorkflowGraph struct {
 	Nodes map[NodeId]WorkflowGraphNode
 	Edges map[EdgeId]WorkflowGraphEdge
@@ -109,6 +201,19 @@ func NewWorkflowGraph() *WorkflowGraph {
 	}
 }
 
+// Clear removes every artifact and action, leaving an empty graph that is
+// ready for reuse.
+func (g *WorkflowGraph) Clear() {
+	if g.Nodes == nil {
+		g.Nodes = make(map[NodeId]WorkflowGraphNode)
+	}
+	if g.Edges == nil {
+		g.Edges = make(map[EdgeId]WorkflowGraphEdge)
+	}
+	clear(g.Nodes)
+	clear(g.Edges)
+}
+
 type Foot map[BoundaryHandle]NodeId
 
 type WorkflowGraphCospan struct {
@@ -140,6 +245,11 @@ type WorkflowGraphBuilder struct {
 	ArtifactHandles map[ArtifactHandle]NodeId
 	ActionHandles   map[ActionHandle]EdgeId
 	Inputs          map[Port]NodeId
+	Progress        ProgressFunc
+
+	// index is built on demand by wiring, and dropped by anything that
+	// restructures the graph.
+	index *wiringIndex
 }
 
 func NewWorkflowGraphBuilder() *WorkflowGraphBuilder {
@@ -160,12 +270,13 @@ func (b *WorkflowGraphBuilder) AddAction(command string, opts ...ActionOption) A
 	handle := NewActionHandle()
 
 	edge := WorkflowGraphEdge{
-		Id:      id,
-		Command: command,
-		Policy:  DefaultPolicy(),
-		Inputs:  make(map[Port]NodeId),
-		Outputs: make(map[Port]NodeId),
-		Env:     make(map[string]string),
+		Id:          id,
+		Command:     command,
+		Policy:      DefaultPolicy(),
+		Inputs:      make(map[Port]NodeId),
+		Outputs:     make(map[Port]NodeId),
+		Env:         make(map[string]string),
+		Annotations: make(map[string]string),
 	}
 
 	for _, opt := range opts {
@@ -174,6 +285,7 @@ func (b *WorkflowGraphBuilder) AddAction(command string, opts ...ActionOption) A
 
 	b.Cospan.Apex.Edges[id] = edge
 	b.ActionHandles[handle] = id
+	b.reportProgress(ProgressActionAdded)
 
 	return handle
 }
@@ -193,10 +305,17 @@ func (b *WorkflowGraphBuilder) AddArtifact(kind ArtifactKind, opts ...ArtifactOp
 
 	b.Cospan.Apex.Nodes[id] = node
 	b.ArtifactHandles[ArtifactHandle(handle)] = id
+	b.reportProgress(ProgressArtifactAdded)
 
 	return ArtifactHandle(handle)
 }
 
+func (b *WorkflowGraphBuilder) reportProgress(event ProgressEvent) {
+	if b.Progress != nil {
+		b.Progress(event)
+	}
+}
+
 func (b *WorkflowGraphBuilder) AddFileArtifact(opts ...ArtifactOption) ArtifactHandle {
 	return b.AddArtifact(ArtifactKindFile, opts...)
 }
@@ -205,9 +324,24 @@ func (b *WorkflowGraphBuilder) AddDirectoryArtifact(opts ...ArtifactOption) Arti
 	return b.AddArtifact(ArtifactKindDirectory, opts...)
 }
 
+func (b *WorkflowGraphBuilder) AddSymlinkArtifact(target string, opts ...ArtifactOption) ArtifactHandle {
+	return b.AddArtifact(ArtifactKindSymlink, append([]ArtifactOption{WithLinkTarget(target)}, opts...)...)
+}
+
+func (b *WorkflowGraphBuilder) AddArchiveArtifact(format, compression string, opts ...ArtifactOption) ArtifactHandle {
+	return b.AddArtifact(ArtifactKindArchive, append([]ArtifactOption{WithArchive(format, compression)}, opts...)...)
+}
+
+func (b *WorkflowGraphBuilder) AddImageArtifact(ref string, opts ...ArtifactOption) ArtifactHandle {
+	return b.AddArtifact(ArtifactKindImage, append([]ArtifactOption{WithImageRef(ref)}, opts...)...)
+}
+
 var (
 	ErrInvalidActionHandle   = errors.New("invalid action handle")
 	ErrInvalidArtifactHandle = errors.New("invalid artifact handle")
+	ErrSelfDependency        = errors.New("artifact is both an input and an output of the same action")
+	ErrDuplicateProducer     = errors.New("artifact already has a producer")
+	ErrInvalidInputOrder     = errors.New("invalid input order")
 )
 
 func (b *WorkflowGraphBuilder) WireOutput(action ActionHandle, port Port, artifact ArtifactHandle) error {
@@ -221,8 +355,27 @@ func (b *WorkflowGraphBuilder) WireOutput(action ActionHandle, port Port, artifa
 		return ErrInvalidArtifactHandle
 	}
 
-	edge := b.Cospan.Apex.Edges[actionId]
+	g := b.Cospan.Apex
+	edge := g.Edges[actionId]
+	if slices.Contains(g.dependencies(actionId), artifactId) {
+		return ErrSelfDependency
+	}
+	// An artifact with two producers is always a bug in the workflow, so
+	// rather than replacing the first producer, both are named.
+	index := b.wiring()
+	if producer, ok := index.producer(artifactId); ok && producer != actionId {
+		return fmt.Errorf("%w: %s is produced by %s and cannot also be produced by %s",
+			ErrDuplicateProducer, g.artifactLabel(artifactId), g.actionLabel(producer), g.actionLabel(actionId))
+	}
+	if err := b.checkProducer(actionId, artifactId); err != nil {
+		return err
+	}
+
+	if old, ok := edge.Outputs[port]; ok {
+		unlink(index.producers, old, actionId)
+	}
 	edge.Outputs[port] = artifactId
+	link(index.producers, artifactId, actionId)
 	b.Cospan.Apex.Edges[actionId] = edge
 	return nil
 }
@@ -239,7 +392,133 @@ func (b *WorkflowGraphBuilder) AddInput(action ActionHandle, port Port, artifact
 	}
 
 	edge := b.Cospan.Apex.Edges[actionId]
+	if slices.Contains(slices.Collect(maps.Values(edge.Outputs)), artifactId) {
+		return ErrSelfDependency
+	}
+	if err := b.checkConsumer(actionId, artifactId); err != nil {
+		return err
+	}
+
+	index := b.wiring()
+	if old, ok := edge.Inputs[port]; ok {
+		unlink(index.consumers, old, actionId)
+	}
 	edge.Inputs[port] = artifactId
+	link(index.consumers, artifactId, actionId)
+	b.Cospan.Apex.Edges[actionId] = edge
+	return nil
+}
+
+// ResolveArtifacts resolves many artifact handles at once. Unlike AddInput,
+// which stops at the first unknown handle, it reports every unknown handle in
+// a single error.
+func (b *WorkflowGraphBuilder) ResolveArtifacts(handles []ArtifactHandle) (map[ArtifactHandle]NodeId, error) {
+	resolved := make(map[ArtifactHandle]NodeId, len(handles))
+	var missing []string
+	for _, handle := range handles {
+		artifactId, ok := b.ArtifactHandles[handle]
+		if !ok {
+			missing = append(missing, Unique(handle).Short())
+			continue
+		}
+		resolved[handle] = artifactId
+	}
+
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidArtifactHandle, strings.Join(missing, ", "))
+	}
+	return resolved, nil
+}
+
+// AddInputs wires many inputs of an action at once. Every handle is checked
+// before anything is wired, so either all inputs are added or none are, and
+// all unknown handles are reported together.
+func (b *WorkflowGraphBuilder) AddInputs(action ActionHandle, inputs map[Port]ArtifactHandle) error {
+	actionId, ok := b.ActionHandles[action]
+	if !ok {
+		return ErrInvalidActionHandle
+	}
+
+	resolved, err := b.ResolveArtifacts(slices.Collect(maps.Values(inputs)))
+	if err != nil {
+		return err
+	}
+
+	edge := b.Cospan.Apex.Edges[actionId]
+	outputs := slices.Collect(maps.Values(edge.Outputs))
+	for _, port := range slices.Sorted(maps.Keys(inputs)) {
+		artifactId := resolved[inputs[port]]
+		if slices.Contains(outputs, artifactId) {
+			return ErrSelfDependency
+		}
+		if err := b.checkConsumer(actionId, artifactId); err != nil {
+			return err
+		}
+	}
+
+	index := b.wiring()
+	for port, artifact := range inputs {
+		if old, ok := edge.Inputs[port]; ok {
+			unlink(index.consumers, old, actionId)
+		}
+		edge.Inputs[port] = resolved[artifact]
+		link(index.consumers, resolved[artifact], actionId)
+	}
+	b.Cospan.Apex.Edges[actionId] = edge
+	return nil
+}
+
+// SetInputOrder declares the positional order of an action's inputs, so that
+// OrderedInputs yields them in that order rather than by port name. Each port
+// must already be an input of the action and may appear only once.
+func (b *WorkflowGraphBuilder) SetInputOrder(action ActionHandle, order []Port) error {
+	actionId, ok := b.ActionHandles[action]
+	if !ok {
+		return ErrInvalidActionHandle
+	}
+
+	edge := b.Cospan.Apex.Edges[actionId]
+	for i, port := range order {
+		if _, ok := edge.Inputs[port]; !ok {
+			return fmt.Errorf("%w: %s is not an input", ErrInvalidInputOrder, port)
+		}
+		if slices.Contains(order[:i], port) {
+			return fmt.Errorf("%w: %s appears more than once", ErrInvalidInputOrder, port)
+		}
+	}
+
+	edge.InputOrder = slices.Clone(order)
+	b.Cospan.Apex.Edges[actionId] = edge
+	return nil
+}
+
+// AddDep records a hidden dependency of an action: an artifact that affects
+// the action's result, and therefore its digest, without being bound to a
+// named input port.
+func (b *WorkflowGraphBuilder) AddDep(action ActionHandle, artifact ArtifactHandle) error {
+	actionId, ok := b.ActionHandles[action]
+	if !ok {
+		return ErrInvalidActionHandle
+	}
+
+	artifactId, ok := b.ArtifactHandles[artifact]
+	if !ok {
+		return ErrInvalidArtifactHandle
+	}
+
+	edge := b.Cospan.Apex.Edges[actionId]
+	if slices.Contains(slices.Collect(maps.Values(edge.Outputs)), artifactId) {
+		return ErrSelfDependency
+	}
+	if slices.Contains(edge.Deps, artifactId) {
+		return nil
+	}
+	if err := b.checkConsumer(actionId, artifactId); err != nil {
+		return err
+	}
+
+	edge.Deps = append(edge.Deps, artifactId)
+	link(b.wiring().consumers, artifactId, actionId)
 	b.Cospan.Apex.Edges[actionId] = edge
 	return nil
 }
@@ -248,6 +527,13 @@ func (b *WorkflowGraphBuilder) AddOutput(action ActionHandle, port Port, artifac
 	return b.WireOutput(action, port, artifact)
 }
 
+// AddExistingOutput declares an existing artifact as an output of an action,
+// for actions that re-expose an artifact under a new name. The artifact must
+// not already be produced by another action.
+func (b *WorkflowGraphBuilder) AddExistingOutput(action ActionHandle, port Port, artifact ArtifactHandle) error {
+	return b.WireOutput(action, port, artifact)
+}
+
 func (b *WorkflowGraphBuilder) AddOutputFile(action ActionHandle, port Port, opts ...ArtifactOption) (ArtifactHandle, error) {
 	artifact := b.AddFileArtifact(opts...)
 	if err := b.WireOutput(action, port, artifact); err != nil {
@@ -285,6 +571,7 @@ func (b *WorkflowGraphBuilder) ExposeLeft(handle BoundaryHandle, artifact Artifa
 }
 
 func (left *WorkflowGraphBuilder) Union(right *WorkflowGraphBuilder) {
+	left.index = nil
 	maps.Copy(left.Cospan.Apex.Nodes, right.Cospan.Apex.Nodes)
 	maps.Copy(left.Cospan.Apex.Edges, right.Cospan.Apex.Edges)
 	maps.Copy(left.ArtifactHandles, right.ArtifactHandles)
@@ -294,6 +581,9 @@ func (left *WorkflowGraphBuilder) Union(right *WorkflowGraphBuilder) {
 }
 
 func (left *WorkflowGraphBuilder) Connect(right *WorkflowGraphBuilder) {
+	// Rewiring below also reaches right's edges, which share their maps.
+	left.index = nil
+	right.index = nil
 	maps.Copy(left.Cospan.Apex.Nodes, right.Cospan.Apex.Nodes)
 	maps.Copy(left.Cospan.Apex.Edges, right.Cospan.Apex.Edges)
 	maps.Copy(left.ArtifactHandles, right.ArtifactHandles)
@@ -315,6 +605,9 @@ func (left *WorkflowGraphBuilder) Connect(right *WorkflowGraphBuilder) {
 		for port, artifactId := range edge.Outputs {
 			edge.Outputs[port] = uf.Find(artifactId)
 		}
+		for i, artifactId := range edge.Deps {
+			edge.Deps[i] = uf.Find(artifactId)
+		}
 		left.Cospan.Apex.Edges[actionId] = edge
 	}
 
@@ -397,6 +690,12 @@ func nodeDigest(id NodeId, ws *WorkflowSpec, cache map[NodeId]Digest) Digest {
 	n := ws.graph.Nodes[id]
 
 	t := tuple.Tuple{int(n.Kind)}
+	if n.Path != "" {
+		t = append(t, n.Path)
+	}
+	if metadata := n.kindMetadata(); len(metadata) > 0 {
+		t = append(t, metadata)
+	}
 	if p, ok := ws.producers[id]; ok {
 		d := edgeDigest(p.ActionId, p.Port, ws, cache)
 		t = append(t, d[:])
@@ -420,6 +719,39 @@ func edgeDigest(id EdgeId, outPort Port, ws *WorkflowSpec, cache map[NodeId]Dige
 		t = append(t, d[:])
 	}
 
+	// Positional commands see inputs in the declared order, so reordering
+	// them changes what the action does.
+	if len(e.InputOrder) > 0 {
+		order := tuple.Tuple{}
+		for _, port := range e.InputOrder {
+			order = append(order, string(port))
+		}
+		t = append(t, order)
+	}
+
+	if e.WorkingDir != "" {
+		t = append(t, tuple.Tuple{"working_dir", e.WorkingDir})
+	}
+
+	if e.NoCache {
+		t = append(t, tuple.Tuple{"no_cache", true})
+	}
+
+	if len(e.Deps) > 0 {
+		depDigests := slice_extensions.Map(e.Deps, func(id NodeId) Digest {
+			return nodeDigest(id, ws, cache)
+		})
+		slices.SortFunc(depDigests, func(a, b Digest) int {
+			return slices.Compare(a[:], b[:])
+		})
+
+		deps := tuple.Tuple{}
+		for _, d := range depDigests {
+			deps = append(deps, d[:])
+		}
+		t = append(t, deps)
+	}
+
 	h := sha256.New()
 	h.Write(t.Pack())
 	return digestSum(h)
@@ -445,6 +777,18 @@ func (b *WorkflowGraphBuilder) Build(target Target, goals []ArtifactHandle, inpu
 		opt(spec)
 	}
 
+	for _, node := range spec.graph.Nodes {
+		if err := node.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	// Digests are computed recursively through producers, so a cycle must be
+	// rejected before computing them.
+	if err := spec.graph.Validate(); err != nil {
+		return nil, err
+	}
+
 	for i, goal := range goals {
 		artifactId, ok := b.ArtifactHandles[goal]
 		if !ok {
@@ -468,6 +812,11 @@ func (b *WorkflowGraphBuilder) Build(target Target, goals []ArtifactHandle, inpu
 				Port:     port,
 			})
 		}
+		for _, artifactId := range edge.Deps {
+			spec.consumers[artifactId] = append(spec.consumers[artifactId], Consumer{
+				ActionId: edge.Id,
+			})
+		}
 		for port, artifactId := range edge.Outputs {
 			spec.producers[artifactId] = Producer{
 				ActionId: edge.Id,
@@ -556,6 +905,40 @@ func (ar ArtifactCursor) Kind() ArtifactKind {
 	return node.Kind
 }
 
+// Path returns the artifact's location relative to the repository root, or
+// the empty string if it has none.
+func (ar ArtifactCursor) Path() string {
+	node := ar.ws.graph.Nodes[ar.id]
+	return node.Path
+}
+
+// Format returns the artifact's advisory format hint, or the empty string if
+// it has none.
+func (ar ArtifactCursor) Format() string {
+	node := ar.ws.graph.Nodes[ar.id]
+	return node.Format
+}
+
+func (ar ArtifactCursor) LinkTarget() string {
+	node := ar.ws.graph.Nodes[ar.id]
+	return node.LinkTarget
+}
+
+func (ar ArtifactCursor) ArchiveFormat() string {
+	node := ar.ws.graph.Nodes[ar.id]
+	return node.ArchiveFormat
+}
+
+func (ar ArtifactCursor) Compression() string {
+	node := ar.ws.graph.Nodes[ar.id]
+	return node.Compression
+}
+
+func (ar ArtifactCursor) ImageRef() string {
+	node := ar.ws.graph.Nodes[ar.id]
+	return node.ImageRef
+}
+
 func (ar ArtifactCursor) Producer() (Port, Action) {
 	producer, ok := ar.ws.producers[ar.id]
 	if !ok {
@@ -564,6 +947,9 @@ func (ar ArtifactCursor) Producer() (Port, Action) {
 	return producer.Port, ActionCursor{ws: ar.ws, id: producer.ActionId}
 }
 
+// Consumers yields each action consuming the artifact with the input port it
+// is bound to. An action that takes the artifact as a dep is yielded with an
+// empty port.
 func (ar ArtifactCursor) Consumers() iter.Seq2[Port, Action] {
 	return func(yield func(Port, Action) bool) {
 		for _, consumer := range ar.ws.consumers[ar.id] {
@@ -605,11 +991,38 @@ func (ar ActionCursor) EnvVar(name string) (string, bool) {
 	return value, ok
 }
 
+func (ar ActionCursor) WorkingDir() string {
+	edge := ar.ws.graph.Edges[ar.id]
+	return edge.WorkingDir
+}
+
+func (ar ActionCursor) Annotations() iter.Seq2[string, string] {
+	return func(yield func(string, string) bool) {
+		edge := ar.ws.graph.Edges[ar.id]
+		for key, value := range edge.Annotations {
+			if !yield(key, value) {
+				return
+			}
+		}
+	}
+}
+
+func (ar ActionCursor) Annotation(key string) (string, bool) {
+	edge := ar.ws.graph.Edges[ar.id]
+	value, ok := edge.Annotations[key]
+	return value, ok
+}
+
 func (ar ActionCursor) Policy() Policy {
 	edge := ar.ws.graph.Edges[ar.id]
 	return edge.Policy
 }
 
+func (ar ActionCursor) NoCache() bool {
+	edge := ar.ws.graph.Edges[ar.id]
+	return edge.NoCache
+}
+
 func (ar ActionCursor) Input(port Port) (Artifact, bool) {
 	edge := ar.ws.graph.Edges[ar.id]
 	artifactId, ok := edge.Inputs[port]
@@ -628,6 +1041,62 @@ func (ar ActionCursor) Output(port Port) (Artifact, bool) {
 	return ArtifactCursor{ws: ar.ws, id: artifactId}, true
 }
 
+// Deps returns the action's hidden dependencies.
+func (ar ActionCursor) Deps() []Artifact {
+	edge := ar.ws.graph.Edges[ar.id]
+	return slice_extensions.Map(edge.Deps, func(id NodeId) Artifact {
+		return ArtifactCursor{ws: ar.ws, id: id}
+	})
+}
+
+// PortArtifact pairs an action port with the artifact bound to it.
+type PortArtifact struct {
+	Port     Port
+	Artifact Artifact
+}
+
+// OrderedInputs returns the action's inputs in their declared order, if one
+// was given, and otherwise sorted by port name, so commands and hashes built
+// from them are reproducible. Inputs missing from the declared order follow
+// it, sorted by port name.
+func (ar ActionCursor) OrderedInputs() []PortArtifact {
+	edge := ar.ws.graph.Edges[ar.id]
+	if len(edge.InputOrder) == 0 {
+		return ar.ordered(edge.Inputs)
+	}
+
+	ordered := make([]PortArtifact, 0, len(edge.Inputs))
+	for _, port := range edge.InputOrder {
+		ordered = append(ordered, PortArtifact{
+			Port:     port,
+			Artifact: ArtifactCursor{ws: ar.ws, id: edge.Inputs[port]},
+		})
+	}
+	for _, rest := range ar.ordered(edge.Inputs) {
+		if !slices.Contains(edge.InputOrder, rest.Port) {
+			ordered = append(ordered, rest)
+		}
+	}
+	return ordered
+}
+
+// OrderedOutputs returns the action's outputs sorted by port name.
+func (ar ActionCursor) OrderedOutputs() []PortArtifact {
+	edge := ar.ws.graph.Edges[ar.id]
+	return ar.ordered(edge.Outputs)
+}
+
+func (ar ActionCursor) ordered(ports map[Port]NodeId) []PortArtifact {
+	ordered := make([]PortArtifact, 0, len(ports))
+	for _, port := range slices.Sorted(maps.Keys(ports)) {
+		ordered = append(ordered, PortArtifact{
+			Port:     port,
+			Artifact: ArtifactCursor{ws: ar.ws, id: ports[port]},
+		})
+	}
+	return ordered
+}
+
 func (ar ActionCursor) Inputs() iter.Seq2[Port, Artifact] {
 	return func(yield func(Port, Artifact) bool) {
 		edge := ar.ws.graph.Edges[ar.id]
@@ -649,3 +1118,22 @@ func (ar ActionCursor) Outputs() iter.Seq2[Port, Artifact] {
 		}
 	}
 }
+
+// Siblings yields the other actions that consume or depend on at least one
+// of this action's inputs and deps. Each sibling is yielded once.
+func (ar ActionCursor) Siblings() iter.Seq[Action] {
+	return func(yield func(Action) bool) {
+		seen := map[EdgeId]bool{ar.id: true}
+		for _, artifactId := range ar.ws.graph.dependencies(ar.id) {
+			for _, consumer := range ar.ws.consumers[artifactId] {
+				if seen[consumer.ActionId] {
+					continue
+				}
+				seen[consumer.ActionId] = true
+				if !yield(ActionCursor{ws: ar.ws, id: consumer.ActionId}) {
+					return
+				}
+			}
+		}
+	}
+}
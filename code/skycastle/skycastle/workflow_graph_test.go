@@ -1,8 +1,15 @@
 package skycastle
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
 	"fmt"
+	"slices"
+	"strings"
 	"testing"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
 )
 
 func must[T any](t *testing.T, v T, err error) T {
@@ -100,6 +107,291 @@ func TestBuild_ConsumersAreOnlyFromInputs_NotFromOutputs(t *testing.T) {
 	}
 }
 
+func TestArtifactPath_RoundTrip(t *testing.T) {
+	b := NewWorkflowGraphBuilder()
+	act := b.AddAction("cat $SRC")
+
+	src := b.AddFileArtifact(WithArtifactPath("src/main.go"))
+	_ = b.AddInput(act, Port("SRC"), src)
+	out, err := b.AddOutputFile(act, Port("OUT"))
+	if err != nil {
+		t.Fatalf("AddOutputFile: %v", err)
+	}
+
+	res, err := b.Build(Target{Path: Path[Relative, File]{path: "p"}, Name: "t"}, []ArtifactHandle{out}, nil)
+	wf := must(t, res, err)
+
+	for act := range wf.Actions() {
+		in, ok := act.Input(Port("SRC"))
+		if !ok {
+			t.Fatalf("expected SRC input")
+		}
+		if in.Path() != "src/main.go" {
+			t.Fatalf("expected path %q, got %q", "src/main.go", in.Path())
+		}
+
+		output, _ := act.Output(Port("OUT"))
+		if output.Path() != "" {
+			t.Fatalf("expected output without a path, got %q", output.Path())
+		}
+	}
+}
+
+func TestArtifactFormat_RoundTripWithoutAffectingDigest(t *testing.T) {
+	build := func(opts ...ArtifactOption) Workflow {
+		b := NewWorkflowGraphBuilder()
+		act := b.AddAction("tar cf $OUT .")
+		out, err := b.AddOutputFile(act, Port("OUT"), opts...)
+		if err != nil {
+			t.Fatalf("AddOutputFile: %v", err)
+		}
+		res, err := b.Build(Target{Path: Path[Relative, File]{path: "p"}, Name: "t"}, []ArtifactHandle{out}, nil)
+		return must(t, res, err)
+	}
+
+	plain := build()
+	tarball := build(WithArtifactFormat("tar"))
+
+	for goal := range tarball.Goals() {
+		if goal.Format() != "tar" {
+			t.Fatalf("expected format %q, got %q", "tar", goal.Format())
+		}
+	}
+	for goal := range plain.Goals() {
+		if goal.Format() != "" {
+			t.Fatalf("expected no format, got %q", goal.Format())
+		}
+	}
+
+	if plain.Digest() != tarball.Digest() {
+		t.Fatalf("expected the format hint not to change the digest")
+	}
+}
+
+func TestBuilder_ReportsProgress(t *testing.T) {
+	counts := make(map[ProgressEvent]int)
+
+	b := NewWorkflowGraphBuilder()
+	b.Progress = func(event ProgressEvent) {
+		counts[event]++
+	}
+
+	act1 := b.AddAction("one")
+	act2 := b.AddAction("two")
+	in := b.AddFileArtifact()
+	_ = b.AddDirectoryArtifact()
+
+	_ = b.AddInput(act1, Port("IN"), in)
+	if _, err := b.AddOutputFile(act2, Port("OUT")); err != nil {
+		t.Fatalf("AddOutputFile: %v", err)
+	}
+
+	if counts[ProgressActionAdded] != 2 {
+		t.Fatalf("expected 2 action events, got %d", counts[ProgressActionAdded])
+	}
+	if counts[ProgressArtifactAdded] != 3 {
+		t.Fatalf("expected 3 artifact events, got %d", counts[ProgressArtifactAdded])
+	}
+}
+
+func TestWiring_RejectsSelfDependency(t *testing.T) {
+	b := NewWorkflowGraphBuilder()
+	act := b.AddAction("touch $X")
+	x := b.AddFileArtifact()
+
+	if err := b.AddInput(act, Port("X"), x); err != nil {
+		t.Fatalf("AddInput: %v", err)
+	}
+	if err := b.AddOutput(act, Port("Y"), x); !errors.Is(err, ErrSelfDependency) {
+		t.Fatalf("expected ErrSelfDependency wiring an input as an output, got %v", err)
+	}
+
+	b2 := NewWorkflowGraphBuilder()
+	act2 := b2.AddAction("touch $X")
+	y := b2.AddFileArtifact()
+
+	if err := b2.AddOutput(act2, Port("Y"), y); err != nil {
+		t.Fatalf("AddOutput: %v", err)
+	}
+	if err := b2.AddInput(act2, Port("X"), y); !errors.Is(err, ErrSelfDependency) {
+		t.Fatalf("expected ErrSelfDependency wiring an output as an input, got %v", err)
+	}
+
+	b3 := NewWorkflowGraphBuilder()
+	act3 := b3.AddAction("touch $X")
+	z := b3.AddFileArtifact()
+
+	if err := b3.AddDep(act3, z); err != nil {
+		t.Fatalf("AddDep: %v", err)
+	}
+	if err := b3.AddOutput(act3, Port("Y"), z); !errors.Is(err, ErrSelfDependency) {
+		t.Fatalf("expected ErrSelfDependency wiring a dep as an output, got %v", err)
+	}
+	if _, _, err := b3.AddActionWithIO("touch $X", ActionIO{
+		Deps:    []ArtifactHandle{z},
+		Outputs: map[Port]ArtifactHandle{"Y": z},
+	}); !errors.Is(err, ErrSelfDependency) {
+		t.Fatalf("expected ErrSelfDependency from a dep that is also an output, got %v", err)
+	}
+}
+
+func TestResolveArtifacts_ReportsAllMissing(t *testing.T) {
+	b := NewWorkflowGraphBuilder()
+	a := b.AddFileArtifact()
+	c := b.AddDirectoryArtifact()
+
+	resolved, err := b.ResolveArtifacts([]ArtifactHandle{a, c})
+	resolved = must(t, resolved, err)
+	if resolved[a] != b.ArtifactHandles[a] || resolved[c] != b.ArtifactHandles[c] {
+		t.Fatalf("unexpected resolution: %v", resolved)
+	}
+
+	missing1 := ArtifactHandle(NewUnique())
+	missing2 := ArtifactHandle(NewUnique())
+
+	_, err = b.ResolveArtifacts([]ArtifactHandle{a, missing1, c, missing2})
+	if !errors.Is(err, ErrInvalidArtifactHandle) {
+		t.Fatalf("expected ErrInvalidArtifactHandle, got %v", err)
+	}
+	for _, h := range []ArtifactHandle{missing1, missing2} {
+		if !strings.Contains(err.Error(), Unique(h).Short()) {
+			t.Fatalf("expected error to name %s, got %v", Unique(h).Short(), err)
+		}
+	}
+	if strings.Contains(err.Error(), Unique(a).Short()) {
+		t.Fatalf("expected error not to name resolved handle, got %v", err)
+	}
+}
+
+func TestAddExistingOutput_RespectsSingleProducer(t *testing.T) {
+	b := NewWorkflowGraphBuilder()
+	src := b.AddFileArtifact()
+	alias := b.AddAction("true")
+
+	if err := b.AddExistingOutput(alias, Port("OUT"), src); err != nil {
+		t.Fatalf("AddExistingOutput: %v", err)
+	}
+
+	wf, err := b.Build(Target{Path: Path[Relative, File]{path: "p"}, Name: "t"}, []ArtifactHandle{src}, nil)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	p, ok := wf.(*WorkflowSpec).producers[b.ArtifactHandles[src]]
+	if !ok || p.ActionId != b.ActionHandles[alias] || p.Port != Port("OUT") {
+		t.Fatalf("expected linked artifact to be produced by the alias action on OUT, got %v", p)
+	}
+
+	// The producer itself may expose the artifact again; only a second
+	// producer is rejected.
+	if err := b.AddExistingOutput(alias, Port("ALSO"), src); err != nil {
+		t.Fatalf("expected the producer to re-expose its own output, got %v", err)
+	}
+	other := b.AddAction("true")
+	if err := b.AddExistingOutput(other, Port("OUT"), src); !errors.Is(err, ErrDuplicateProducer) {
+		t.Fatalf("expected ErrDuplicateProducer, got %v", err)
+	}
+}
+
+func TestAddOutput_RejectsSecondProducer(t *testing.T) {
+	b := NewWorkflowGraphBuilder()
+	first := b.AddAction("first")
+	second := b.AddAction("second")
+	out, err := b.AddOutputFile(first, Port("OUT"))
+	if err != nil {
+		t.Fatalf("AddOutputFile: %v", err)
+	}
+
+	// The producer may wire the artifact again, for example under a new port.
+	if err := b.AddOutput(first, Port("ALIAS"), out); err != nil {
+		t.Fatalf("AddOutput by the same producer: %v", err)
+	}
+
+	err = b.AddOutput(second, Port("OUT"), out)
+	if !errors.Is(err, ErrDuplicateProducer) {
+		t.Fatalf("expected ErrDuplicateProducer, got %v", err)
+	}
+	if !strings.Contains(err.Error(), `"first"`) || !strings.Contains(err.Error(), `"second"`) {
+		t.Fatalf("expected the error to name both actions, got %v", err)
+	}
+	if len(b.Cospan.Apex.Edges[b.ActionHandles[second]].Outputs) != 0 {
+		t.Fatalf("expected the second producer not to be wired")
+	}
+}
+
+func TestAddInputs_AllOrNothing(t *testing.T) {
+	b := NewWorkflowGraphBuilder()
+	act := b.AddAction("cat $A $B")
+	a := b.AddFileArtifact()
+	c := b.AddFileArtifact()
+
+	err := b.AddInputs(act, map[Port]ArtifactHandle{
+		"A": a,
+		"B": ArtifactHandle(NewUnique()),
+	})
+	if !errors.Is(err, ErrInvalidArtifactHandle) {
+		t.Fatalf("expected ErrInvalidArtifactHandle, got %v", err)
+	}
+	if inputs := b.Cospan.Apex.Edges[b.ActionHandles[act]].Inputs; len(inputs) != 0 {
+		t.Fatalf("expected no inputs wired after a failed AddInputs, got %v", inputs)
+	}
+
+	if err := b.AddInputs(act, map[Port]ArtifactHandle{"A": a, "B": c}); err != nil {
+		t.Fatalf("AddInputs: %v", err)
+	}
+	inputs := b.Cospan.Apex.Edges[b.ActionHandles[act]].Inputs
+	if inputs["A"] != b.ArtifactHandles[a] || inputs["B"] != b.ArtifactHandles[c] {
+		t.Fatalf("unexpected inputs: %v", inputs)
+	}
+}
+
+func benchmarkInputs(b *testing.B) (*WorkflowGraphBuilder, map[Port]ArtifactHandle) {
+	b.Helper()
+	builder := NewWorkflowGraphBuilder()
+	inputs := make(map[Port]ArtifactHandle, 50)
+	for i := range 50 {
+		inputs[Port(fmt.Sprintf("IN_%d", i))] = builder.AddFileArtifact()
+	}
+	return builder, inputs
+}
+
+func BenchmarkAddInput_50(b *testing.B) {
+	builder, inputs := benchmarkInputs(b)
+	for b.Loop() {
+		act := builder.AddAction("true")
+		for port, artifact := range inputs {
+			if err := builder.AddInput(act, port, artifact); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkAddInputs_50(b *testing.B) {
+	builder, inputs := benchmarkInputs(b)
+	for b.Loop() {
+		act := builder.AddAction("true")
+		if err := builder.AddInputs(act, inputs); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestBuild_RejectsUnknownArtifactKind(t *testing.T) {
+	b := NewWorkflowGraphBuilder()
+
+	act := b.AddAction("echo hi")
+	in := b.AddArtifact(ArtifactKind(42))
+	out := b.AddFileArtifact()
+
+	_ = b.AddInput(act, Port("IN"), in)
+	_ = b.AddOutput(act, Port("OUT"), out)
+
+	_, err := b.Build(Target{Path: Path[Relative, File]{path: "p"}, Name: "t"}, []ArtifactHandle{out}, nil)
+	if !errors.Is(err, ErrInvalidArtifactKind) {
+		t.Fatalf("expected ErrInvalidArtifactKind, got %v", err)
+	}
+}
+
 func TestDigest_DeterministicWithPortMapOrder(t *testing.T) {
 	// Two separate builders produce semantically identical graphs but
 	// we wire inputs in opposite order. Digest should match because edgeDigest sorts ports.
@@ -211,6 +503,125 @@ func TestDigest_ChangesWhenPolicyChanges(t *testing.T) {
 	}
 }
 
+func TestDigest_ChangesWhenNoCacheChanges(t *testing.T) {
+	build := func(noCache bool) Workflow {
+		b := NewWorkflowGraphBuilder()
+		act := b.AddAction("run", WithNoCache(noCache))
+		in := b.AddFileArtifact()
+		out := b.AddFileArtifact()
+
+		_ = b.AddInput(act, Port("in"), in)
+		_ = b.AddOutput(act, Port("out"), out)
+
+		res, err := b.Build(Target{Path: Path[Relative, File]{path: "p"}, Name: "t"}, []ArtifactHandle{out}, nil)
+		return must(t, res, err)
+	}
+
+	cached := build(false)
+	uncached := build(true)
+	if cached.Digest() == uncached.Digest() {
+		t.Fatalf("expected digest to change when no_cache changes")
+	}
+
+	for act := range cached.Actions() {
+		if act.NoCache() {
+			t.Fatalf("expected action to be cacheable by default")
+		}
+	}
+
+	// Cacheable actions keep the digests they had before no_cache existed.
+	b := NewWorkflowGraphBuilder()
+	act := b.AddAction("run")
+	out, err := b.AddOutputFile(act, Port("out"))
+	out = must(t, out, err)
+	wf, err := b.Build(Target{Path: Path[Relative, File]{path: "p"}, Name: "t"}, []ArtifactHandle{out}, nil)
+	wf = must(t, wf, err)
+	h := sha256.New()
+	h.Write(tuple.Tuple{"run", fmt.Sprintf("%v", DefaultPolicy()), "out"}.Pack())
+	if got := edgeDigest(b.ActionHandles[act], Port("out"), wf.(*WorkflowSpec), map[NodeId]Digest{}); got != digestSum(h) {
+		t.Fatalf("expected a cacheable action's digest not to include no_cache")
+	}
+	for act := range uncached.Actions() {
+		if !act.NoCache() {
+			t.Fatalf("expected action to be marked no-cache")
+		}
+	}
+}
+
+func TestDigest_WorkingDirCountsAndAnnotationsDoNot(t *testing.T) {
+	build := func(opts ...ActionOption) Workflow {
+		b := NewWorkflowGraphBuilder()
+		act := b.AddAction("run", opts...)
+		out := b.AddFileArtifact()
+		_ = b.AddOutput(act, Port("out"), out)
+
+		res, err := b.Build(Target{Path: Path[Relative, File]{path: "p"}, Name: "t"}, []ArtifactHandle{out}, nil)
+		return must(t, res, err)
+	}
+
+	plain := build()
+	if plain.Digest() == build(WithWorkingDir("web")).Digest() {
+		t.Fatalf("expected digest to change when the working dir changes")
+	}
+
+	annotated := build(WithAnnotation("owner", "web"))
+	if plain.Digest() != annotated.Digest() {
+		t.Fatalf("expected annotations not to change the digest")
+	}
+
+	for act := range annotated.Actions() {
+		if act.WorkingDir() != "" {
+			t.Fatalf("expected the repository root by default, got %q", act.WorkingDir())
+		}
+		if owner, ok := act.Annotation("owner"); !ok || owner != "web" {
+			t.Fatalf("expected owner annotation, got %q, %v", owner, ok)
+		}
+	}
+}
+
+func TestDeps_RoundTripAndDigest(t *testing.T) {
+	build := func(withDep bool) Workflow {
+		b := NewWorkflowGraphBuilder()
+		act := b.AddAction("make")
+		lockfile := b.AddFileArtifact(WithArtifactPath("go.sum"))
+		out := b.AddFileArtifact()
+
+		if withDep {
+			if err := b.AddDep(act, lockfile); err != nil {
+				t.Fatalf("AddDep: %v", err)
+			}
+			// Adding the same dep twice is a no-op.
+			if err := b.AddDep(act, lockfile); err != nil {
+				t.Fatalf("AddDep: %v", err)
+			}
+		}
+		_ = b.AddOutput(act, Port("OUT"), out)
+
+		res, err := b.Build(Target{Path: Path[Relative, File]{path: "p"}, Name: "t"}, []ArtifactHandle{out}, nil)
+		return must(t, res, err)
+	}
+
+	without := build(false)
+	with := build(true)
+
+	if without.Digest() == with.Digest() {
+		t.Fatalf("expected deps to contribute to the digest")
+	}
+
+	for act := range with.Actions() {
+		deps := act.Deps()
+		if len(deps) != 1 {
+			t.Fatalf("expected 1 dep, got %d", len(deps))
+		}
+		if deps[0].Path() != "go.sum" {
+			t.Fatalf("expected dep go.sum, got %q", deps[0].Path())
+		}
+		for range act.Inputs() {
+			t.Fatalf("expected deps not to be exposed as named inputs")
+		}
+	}
+}
+
 func TestDigest_IgnoresUnreachableGraphParts(t *testing.T) {
 	b := NewWorkflowGraphBuilder()
 
@@ -250,6 +661,159 @@ func TestDigest_IgnoresUnreachableGraphParts(t *testing.T) {
 	}
 }
 
+func TestOrderedInputsAndOutputs_SortedByPort(t *testing.T) {
+	b := NewWorkflowGraphBuilder()
+	act := b.AddAction("cc")
+
+	for _, port := range []Port{"SRC_C", "SRC_A", "SRC_B"} {
+		_ = b.AddInput(act, port, b.AddFileArtifact(WithArtifactDescription(string(port))))
+	}
+
+	var goals []ArtifactHandle
+	for _, port := range []Port{"OBJ", "LOG", "DEPS"} {
+		out, err := b.AddOutputFile(act, port, WithArtifactDescription(string(port)))
+		if err != nil {
+			t.Fatalf("AddOutputFile: %v", err)
+		}
+		goals = append(goals, out)
+	}
+
+	res, err := b.Build(Target{Path: Path[Relative, File]{path: "p"}, Name: "t"}, goals, nil)
+	wf := must(t, res, err)
+
+	var action Action
+	for act := range wf.Actions() {
+		action = act
+	}
+
+	ports := func(bindings []PortArtifact) []Port {
+		out := make([]Port, len(bindings))
+		for i, binding := range bindings {
+			if binding.Artifact.Description() != string(binding.Port) {
+				t.Fatalf("port %s bound to unexpected artifact %q", binding.Port, binding.Artifact.Description())
+			}
+			out[i] = binding.Port
+		}
+		return out
+	}
+
+	for range 10 {
+		if got, want := ports(action.OrderedInputs()), []Port{"SRC_A", "SRC_B", "SRC_C"}; !slices.Equal(got, want) {
+			t.Fatalf("OrderedInputs: got %v, want %v", got, want)
+		}
+		if got, want := ports(action.OrderedOutputs()), []Port{"DEPS", "LOG", "OBJ"}; !slices.Equal(got, want) {
+			t.Fatalf("OrderedOutputs: got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestSiblings_SharedInput(t *testing.T) {
+	b := NewWorkflowGraphBuilder()
+
+	shared := b.AddFileArtifact(WithArtifactDescription("shared"))
+	other := b.AddFileArtifact(WithArtifactDescription("other"))
+
+	actA := b.AddAction("a")
+	actB := b.AddAction("b")
+	actC := b.AddAction("c")
+
+	_ = b.AddInput(actA, Port("IN"), shared)
+	_ = b.AddInput(actA, Port("OTHER"), other)
+	_ = b.AddInput(actB, Port("IN"), shared)
+	_ = b.AddInput(actC, Port("IN"), other)
+
+	outA, err := b.AddOutputFile(actA, Port("OUT"))
+	if err != nil {
+		t.Fatalf("AddOutputFile: %v", err)
+	}
+	outB, err := b.AddOutputFile(actB, Port("OUT"))
+	if err != nil {
+		t.Fatalf("AddOutputFile: %v", err)
+	}
+	outC, err := b.AddOutputFile(actC, Port("OUT"))
+	if err != nil {
+		t.Fatalf("AddOutputFile: %v", err)
+	}
+
+	res, err := b.Build(Target{Path: Path[Relative, File]{path: "p"}, Name: "t"}, []ArtifactHandle{outA, outB, outC}, nil)
+	wf := must(t, res, err)
+
+	commands := func(act Action) []string {
+		var out []string
+		for sibling := range act.Siblings() {
+			out = append(out, sibling.Command())
+		}
+		slices.Sort(out)
+		return out
+	}
+
+	byCommand := make(map[string]Action)
+	for act := range wf.Actions() {
+		byCommand[act.Command()] = act
+	}
+
+	if got, want := commands(byCommand["a"]), []string{"b", "c"}; !slices.Equal(got, want) {
+		t.Fatalf("siblings of a: got %v, want %v", got, want)
+	}
+	if got, want := commands(byCommand["b"]), []string{"a"}; !slices.Equal(got, want) {
+		t.Fatalf("siblings of b: got %v, want %v", got, want)
+	}
+	if got, want := commands(byCommand["c"]), []string{"a"}; !slices.Equal(got, want) {
+		t.Fatalf("siblings of c: got %v, want %v", got, want)
+	}
+}
+
+func TestConsumersAndSiblings_IncludeDeps(t *testing.T) {
+	b := NewWorkflowGraphBuilder()
+
+	shared := b.AddFileArtifact(WithArtifactDescription("shared"))
+	reader := b.AddAction("reader")
+	watcher := b.AddAction("watcher")
+
+	if err := b.AddInput(reader, Port("IN"), shared); err != nil {
+		t.Fatalf("AddInput: %v", err)
+	}
+	if err := b.AddDep(watcher, shared); err != nil {
+		t.Fatalf("AddDep: %v", err)
+	}
+	outReader, err := b.AddOutputFile(reader, Port("OUT"))
+	if err != nil {
+		t.Fatalf("AddOutputFile: %v", err)
+	}
+	outWatcher, err := b.AddOutputFile(watcher, Port("OUT"))
+	if err != nil {
+		t.Fatalf("AddOutputFile: %v", err)
+	}
+
+	res, err := b.Build(Target{Path: Path[Relative, File]{path: "p"}, Name: "t"}, []ArtifactHandle{outReader, outWatcher}, nil)
+	wf := must(t, res, err)
+
+	var consumers []string
+	for artifact := range wf.Artifacts() {
+		if artifact.Description() != "shared" {
+			continue
+		}
+		for port, act := range artifact.Consumers() {
+			consumers = append(consumers, fmt.Sprintf("%s:%s", act.Command(), port))
+		}
+	}
+	slices.Sort(consumers)
+	if want := []string{"reader:IN", "watcher:"}; !slices.Equal(consumers, want) {
+		t.Fatalf("consumers of shared: got %v, want %v", consumers, want)
+	}
+
+	for act := range wf.Actions() {
+		var siblings []string
+		for sibling := range act.Siblings() {
+			siblings = append(siblings, sibling.Command())
+		}
+		want := map[string]string{"reader": "watcher", "watcher": "reader"}[act.Command()]
+		if !slices.Equal(siblings, []string{want}) {
+			t.Fatalf("siblings of %s: got %v, want [%s]", act.Command(), siblings, want)
+		}
+	}
+}
+
 func TestUnion_HandleValidityAfterUnion(t *testing.T) {
 	// Test that all handles remain valid and usable after Union operation
 	leftBuilder := NewWorkflowGraphBuilder()
@@ -790,3 +1354,144 @@ func TestUnion_HandleCollisionResistance(t *testing.T) {
 		t.Errorf("Expected %d total actions, got %d", expectedActions, len(builders[0].ActionHandles))
 	}
 }
+
+func TestClearedGraph_ReturnsEmptyCollections(t *testing.T) {
+	b := NewWorkflowGraphBuilder()
+	src := b.AddFileArtifact(WithArtifactPath("main.go"))
+	act := b.AddAction("go build")
+	if err := b.AddInput(act, Port("SRC"), src); err != nil {
+		t.Fatalf("AddInput: %v", err)
+	}
+
+	g := b.Cospan.Apex
+	g.Clear()
+	if g.Nodes == nil || g.Edges == nil || len(g.Nodes) != 0 || len(g.Edges) != 0 {
+		t.Fatalf("expected empty non-nil maps after Clear, got %+v", g)
+	}
+
+	if err := g.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if groups := g.FindDuplicates(); groups == nil || len(groups) != 0 {
+		t.Fatalf("expected empty non-nil duplicate groups, got %#v", groups)
+	}
+
+	var buf bytes.Buffer
+	if err := g.ExportJSONL(&buf); err != nil {
+		t.Fatalf("ExportJSONL: %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("expected no records, got %q", buf.String())
+	}
+	imported, err := ImportJSONL(&buf)
+	if err != nil {
+		t.Fatalf("ImportJSONL: %v", err)
+	}
+	if imported.Nodes == nil || imported.Edges == nil {
+		t.Fatalf("expected non-nil maps from ImportJSONL, got %+v", imported)
+	}
+
+	wf, err := b.Build(Target{Path: Path[Relative, File]{path: "p"}, Name: "t"}, nil, nil)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	for range wf.Actions() {
+		t.Fatalf("expected no actions")
+	}
+	for range wf.Artifacts() {
+		t.Fatalf("expected no artifacts")
+	}
+	for range wf.Goals() {
+		t.Fatalf("expected no goals")
+	}
+	for range wf.Inputs() {
+		t.Fatalf("expected no inputs")
+	}
+
+	if levels := ExecutionLevels(wf); levels == nil || len(levels) != 0 {
+		t.Fatalf("expected empty non-nil levels, got %#v", levels)
+	}
+	if level, width := MaxParallelWidth(ExecutionLevels(wf)); level != 0 || width != 0 {
+		t.Fatalf("expected zero width, got level %d width %d", level, width)
+	}
+	if groups := wf.DuplicateActions(); groups == nil || len(groups) != 0 {
+		t.Fatalf("expected empty non-nil duplicate groups, got %#v", groups)
+	}
+	if manifest := GoalManifest(wf); manifest == nil || len(manifest) != 0 {
+		t.Fatalf("expected empty non-nil manifest, got %#v", manifest)
+	}
+}
+
+func TestSingleAction_ReturnsEmptyCollections(t *testing.T) {
+	b := NewWorkflowGraphBuilder()
+	b.AddAction("true")
+
+	wf, err := b.Build(Target{Path: Path[Relative, File]{path: "p"}, Name: "t"}, nil, nil)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	actions := slices.Collect(wf.Actions())
+	if len(actions) != 1 {
+		t.Fatalf("expected 1 action, got %d", len(actions))
+	}
+	action := actions[0]
+
+	if inputs := action.OrderedInputs(); inputs == nil || len(inputs) != 0 {
+		t.Fatalf("expected empty non-nil inputs, got %#v", inputs)
+	}
+	if outputs := action.OrderedOutputs(); outputs == nil || len(outputs) != 0 {
+		t.Fatalf("expected empty non-nil outputs, got %#v", outputs)
+	}
+	if deps := action.Deps(); deps == nil || len(deps) != 0 {
+		t.Fatalf("expected empty non-nil deps, got %#v", deps)
+	}
+	for range action.Inputs() {
+		t.Fatalf("expected no inputs")
+	}
+	for range action.Outputs() {
+		t.Fatalf("expected no outputs")
+	}
+	for range action.Siblings() {
+		t.Fatalf("expected no siblings")
+	}
+
+	if _, ok := b.Cospan.Apex.FindCycle(); ok {
+		t.Fatalf("expected no cycle")
+	}
+}
+
+func TestSetInputOrder_ChangesDigestAndRejectsBadPorts(t *testing.T) {
+	digest := func(order []Port) (Digest, error) {
+		b := NewWorkflowGraphBuilder()
+		act := b.AddAction("cat $1 $2")
+		for _, port := range []Port{"A", "B"} {
+			if err := b.AddInput(act, port, b.AddFileArtifact(WithArtifactPath(string(port)))); err != nil {
+				t.Fatalf("AddInput: %v", err)
+			}
+		}
+		if err := b.SetInputOrder(act, order); err != nil {
+			return Digest{}, err
+		}
+		out, err := b.AddOutputFile(act, Port("OUT"))
+		out = must(t, out, err)
+		wf, err := b.Build(Target{Path: Path[Relative, File]{path: "p"}, Name: "t"}, []ArtifactHandle{out}, nil)
+		wf = must(t, wf, err)
+		return wf.Digest(), nil
+	}
+
+	ab, err := digest([]Port{"A", "B"})
+	ab = must(t, ab, err)
+	ba, err := digest([]Port{"B", "A"})
+	ba = must(t, ba, err)
+	if ab == ba {
+		t.Fatalf("expected the input order to change the digest")
+	}
+
+	if _, err := digest([]Port{"A", "C"}); !errors.Is(err, ErrInvalidInputOrder) {
+		t.Fatalf("expected ErrInvalidInputOrder for an unknown port, got %v", err)
+	}
+	if _, err := digest([]Port{"A", "A"}); !errors.Is(err, ErrInvalidInputOrder) {
+		t.Fatalf("expected ErrInvalidInputOrder for a repeated port, got %v", err)
+	}
+}
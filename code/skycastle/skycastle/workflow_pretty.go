@@ -84,6 +84,12 @@ func addArtifact(parent treeprint.Tree, st workflowStyles, a Artifact) {
 	art := parent.AddBranch(st.Key.Sprint("Artifact"))
 	art.AddNode(fmt.Sprintf("%s %s", st.Key.Sprint("Kind:"), st.Kind.Sprint(safeString(a.Kind()))))
 	art.AddNode(fmt.Sprintf("%s %s", st.Key.Sprint("Description:"), st.Value.Sprint(a.Description())))
+	if a.Path() != "" {
+		art.AddNode(fmt.Sprintf("%s %s", st.Key.Sprint("Path:"), st.Value.Sprint(a.Path())))
+	}
+	if a.Format() != "" {
+		art.AddNode(fmt.Sprintf("%s %s", st.Key.Sprint("Format:"), st.Value.Sprint(a.Format())))
+	}
 
 	port, producer := a.Producer()
 	if producer == nil {
@@ -99,6 +105,9 @@ func addAction(parent treeprint.Tree, st workflowStyles, act Action) {
 	ac := parent.AddBranch(st.Key.Sprint("Action"))
 	ac.AddNode(fmt.Sprintf("%s %s", st.Key.Sprint("Description:"), st.Value.Sprint(act.Description())))
 	ac.AddNode(fmt.Sprintf("%s %s", st.Key.Sprint("Command:"), st.Command.Sprint(act.Command())))
+	if act.NoCache() {
+		ac.AddNode(fmt.Sprintf("%s %s", st.Key.Sprint("NoCache:"), st.Value.Sprint(true)))
+	}
 
 	pol := ac.AddBranch(st.Key.Sprint("Policy:"))
 	p := act.Policy()
@@ -11,6 +11,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -19,11 +20,25 @@ import (
 	"github.com/aws/aws-sdk-go-v2/credentials/ec2rolecreds"
 	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
 	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-secure-stdlib/parseutil"
 	"github.com/openbao/openbao/api/v2"
 	"github.com/openbao/openbao/command/agentproxyshared/auth"
 )
 
+const (
+	imdsTokenTTLHeader    = "X-Aws-Ec2-Metadata-Token-Ttl-Seconds"
+	maxImdsTokenTTL       = 6 * time.Hour
+	defaultSigningService = "sts"
+	redacted              = "[REDACTED]"
+)
+
+// sensitiveHeaders are masked before STS request headers are logged: with the
+// signature or session token, anyone reading the logs could replay the login.
+var sensitiveHeaders = []string{"Authorization", "X-Amz-Security-Token"}
+
 type awsMethod struct {
 	logger            hclog.Logger
 	mountPath         string
@@ -31,6 +46,18 @@ type awsMethod struct {
 	useGlobalEndpoint bool
 	serverId          string
 	role              string
+	imdsEndpoint      string
+	imdsTokenTTL      time.Duration
+	namespace         string
+
+	// signingRegion and signingService override the SigV4 scope used to sign
+	// the STS request, for STS-compatible endpoints that expect a different
+	// scope than the request region and "sts".
+	signingRegion  string
+	signingService string
+
+	// now is the time source used to sign STS requests.
+	now func() time.Time
 }
 
 func NewAWSAuthMethod(conf *auth.AuthConfig) (auth.AuthMethod, error) {
@@ -41,6 +68,7 @@ func NewAWSAuthMethod(conf *auth.AuthConfig) (auth.AuthMethod, error) {
 	a := &awsMethod{
 		logger:    conf.Logger,
 		mountPath: conf.MountPath,
+		now:       time.Now,
 	}
 
 	if conf.Config != nil {
@@ -79,6 +107,61 @@ func NewAWSAuthMethod(conf *auth.AuthConfig) (auth.AuthMethod, error) {
 			}
 			a.role = role
 		}
+
+		imdsEndpointRaw, ok := conf.Config["imds_endpoint"]
+		if ok {
+			imdsEndpoint, ok := imdsEndpointRaw.(string)
+			if !ok {
+				return nil, errors.New("could not convert 'imds_endpoint' config value to string")
+			}
+			a.imdsEndpoint = imdsEndpoint
+		}
+
+		imdsTokenTTLRaw, ok := conf.Config["imds_token_ttl"]
+		if ok {
+			imdsTokenTTL, err := parseutil.ParseDurationSecond(imdsTokenTTLRaw)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing 'imds_token_ttl' value: %w", err)
+			}
+			if imdsTokenTTL < time.Second || imdsTokenTTL > maxImdsTokenTTL {
+				return nil, fmt.Errorf("'imds_token_ttl' must be between 1s and %s", maxImdsTokenTTL)
+			}
+			a.imdsTokenTTL = imdsTokenTTL
+		}
+
+		// Response wrapping is set with wrap_ttl on the auto_auth method
+		// block. The auth handler only expects a wrapped login response when
+		// it requested the wrapping itself, so the method must not ask for it.
+		if _, ok := conf.Config["wrap_ttl"]; ok {
+			return nil, errors.New("'wrap_ttl' is not an AWS auth method config value; set wrap_ttl on the auto_auth method block instead")
+		}
+
+		namespaceRaw, ok := conf.Config["namespace"]
+		if ok {
+			namespace, ok := namespaceRaw.(string)
+			if !ok {
+				return nil, errors.New("could not convert 'namespace' config value to string")
+			}
+			a.namespace = namespace
+		}
+
+		signingRegionRaw, ok := conf.Config["signing_region"]
+		if ok {
+			signingRegion, ok := signingRegionRaw.(string)
+			if !ok {
+				return nil, errors.New("could not convert 'signing_region' config value to string")
+			}
+			a.signingRegion = signingRegion
+		}
+
+		signingServiceRaw, ok := conf.Config["signing_service"]
+		if ok {
+			signingService, ok := signingServiceRaw.(string)
+			if !ok {
+				return nil, errors.New("could not convert 'signing_service' config value to string")
+			}
+			a.signingService = signingService
+		}
 	}
 
 	return a, nil
@@ -90,12 +173,20 @@ func (j *awsMethod) Authenticate(ctx context.Context, client *api.Client) (strin
 		return "", nil, nil, fmt.Errorf("failed to load AWS config: %w", err)
 	}
 
-	creds, err := retrieveImdsCredentials(ctx, cfg)
+	creds, err := retrieveImdsCredentials(ctx, cfg, j.imdsOptions)
 	if err != nil {
 		return "", nil, nil, fmt.Errorf("failed to retrieve credentials from IMDS: %w", err)
 	}
 
-	sts_endpoint, err := resolveStsEndpoint(ctx, cfg.Region, j.useGlobalEndpoint)
+	j.logger.Debug("retrieved AWS credentials", "source", creds.Source, "temporary", creds.SessionToken != "")
+
+	return j.loginRequest(ctx, creds, cfg.Region)
+}
+
+// loginRequest builds the OpenBao login request from a signed STS
+// GetCallerIdentity request.
+func (j *awsMethod) loginRequest(ctx context.Context, creds aws.Credentials, region string) (string, http.Header, map[string]interface{}, error) {
+	sts_endpoint, err := resolveStsEndpoint(ctx, region, j.useGlobalEndpoint)
 	if err != nil {
 		return "", nil, nil, fmt.Errorf("failed to resolve STS endpoint: %w", err)
 	}
@@ -120,10 +211,29 @@ func (j *awsMethod) Authenticate(ctx context.Context, client *api.Client) (strin
 	sts_req.Header.Set("X-Amz-Content-Sha256", sts_req_hash)
 
 	signer := v4.NewSigner()
-	if err := signer.SignHTTP(ctx, creds, sts_req, sts_req_hash, "sts", cfg.Region, time.Now()); err != nil {
+	signingService := defaultSigningService
+	if j.signingService != "" {
+		signingService = j.signingService
+	}
+	signingRegion := region
+	if j.signingRegion != "" {
+		signingRegion = j.signingRegion
+	}
+
+	// For temporary credentials, such as those from IMDS, SignHTTP adds and
+	// signs X-Amz-Security-Token; every header is forwarded below, so it
+	// reaches OpenBao unchanged.
+	if err := signer.SignHTTP(ctx, creds, sts_req, sts_req_hash, signingService, signingRegion, j.now()); err != nil {
 		return "", nil, nil, fmt.Errorf("failed to sign STS request: %w", err)
 	}
 
+	j.logger.Debug("signed STS request",
+		"url", sts_endpoint.String(),
+		"signing_region", signingRegion,
+		"signing_service", signingService,
+		"headers", redactHeaders(sts_req.Header),
+	)
+
 	sts_header_map := make(map[string]any, len(sts_req.Header))
 	for k, vs := range sts_req.Header {
 		switch len(vs) {
@@ -155,9 +265,24 @@ func (j *awsMethod) Authenticate(ctx context.Context, client *api.Client) (strin
 		"Content-Type": []string{"application/json"},
 	}
 
+	if j.namespace != "" {
+		auth_req_header.Set(api.NamespaceHeaderName, j.namespace)
+	}
+
 	return auth_req_mount_path, auth_req_header, auth_req_payload, nil
 }
 
+// redactHeaders returns a copy of header that is safe to log.
+func redactHeaders(header http.Header) http.Header {
+	safe := header.Clone()
+	for _, name := range sensitiveHeaders {
+		if safe.Get(name) != "" {
+			safe.Set(name, redacted)
+		}
+	}
+	return safe
+}
+
 func loadConfig(ctx context.Context, region string) (aws.Config, error) {
 	var opts awsConfig.LoadOptionsFunc
 	if region != "" {
@@ -169,8 +294,40 @@ func loadConfig(ctx context.Context, region string) (aws.Config, error) {
 	return awsConfig.LoadDefaultConfig(ctx, opts)
 }
 
-func retrieveImdsCredentials(ctx context.Context, cfg aws.Config) (aws.Credentials, error) {
-	imdsClient := imds.NewFromConfig(cfg)
+// imdsOptions applies the configured IMDS endpoint and token TTL, if any, to
+// the IMDS client. Containers commonly reach IMDS through a local metadata
+// proxy rather than the link-local address, so the endpoint must be
+// overridable.
+func (j *awsMethod) imdsOptions(opts *imds.Options) {
+	if j.imdsEndpoint != "" {
+		opts.Endpoint = j.imdsEndpoint
+	}
+
+	if j.imdsTokenTTL != 0 {
+		opts.APIOptions = append(opts.APIOptions, withImdsTokenTTL(j.imdsTokenTTL))
+	}
+}
+
+// withImdsTokenTTL overrides the TTL requested for IMDSv2 session tokens. The
+// SDK does not expose the TTL as a client option, so the header set by the
+// token request serializer is rewritten before the request is sent.
+func withImdsTokenTTL(ttl time.Duration) func(*middleware.Stack) error {
+	return func(stack *middleware.Stack) error {
+		return stack.Build.Add(middleware.BuildMiddlewareFunc(
+			"ImdsTokenTTL",
+			func(ctx context.Context, in middleware.BuildInput, next middleware.BuildHandler) (middleware.BuildOutput, middleware.Metadata, error) {
+				req, ok := in.Request.(*smithyhttp.Request)
+				if ok && req.Header.Get(imdsTokenTTLHeader) != "" {
+					req.Header.Set(imdsTokenTTLHeader, strconv.Itoa(int(ttl/time.Second)))
+				}
+				return next.HandleBuild(ctx, in)
+			},
+		), middleware.After)
+	}
+}
+
+func retrieveImdsCredentials(ctx context.Context, cfg aws.Config, optFns ...func(*imds.Options)) (aws.Credentials, error) {
+	imdsClient := imds.NewFromConfig(cfg, optFns...)
 
 	imdsCredsProvider := ec2rolecreds.New(
 		func(opts *ec2rolecreds.Options) {
@@ -0,0 +1,391 @@
+package aws
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/openbao/openbao/api/v2"
+	"github.com/openbao/openbao/command/agentproxyshared/auth"
+	"github.com/openbao/openbao/sdk/v2/helper/logging"
+)
+
+const (
+	testImdsRole            = "test-role"
+	testImdsAccessKeyID     = "AKIDEXAMPLE"
+	testImdsSecretAccessKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+	testImdsSessionToken    = "session-token"
+)
+
+// imdsStub is a minimal IMDSv2 server serving a single instance role.
+type imdsStub struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	tokenTTLs []string
+	requests  int
+}
+
+func newImdsStub(t *testing.T) *imdsStub {
+	t.Helper()
+
+	stub := &imdsStub{}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("PUT /latest/api/token", func(w http.ResponseWriter, r *http.Request) {
+		ttl := r.Header.Get(imdsTokenTTLHeader)
+
+		stub.mu.Lock()
+		stub.tokenTTLs = append(stub.tokenTTLs, ttl)
+		stub.requests++
+		stub.mu.Unlock()
+
+		w.Header().Set(imdsTokenTTLHeader, ttl)
+		w.Write([]byte("imds-token"))
+	})
+	mux.HandleFunc("GET /latest/meta-data/iam/security-credentials/", func(w http.ResponseWriter, r *http.Request) {
+		stub.mu.Lock()
+		stub.requests++
+		stub.mu.Unlock()
+
+		w.Write([]byte(testImdsRole))
+	})
+	mux.HandleFunc("GET /latest/meta-data/iam/security-credentials/"+testImdsRole, func(w http.ResponseWriter, r *http.Request) {
+		stub.mu.Lock()
+		stub.requests++
+		stub.mu.Unlock()
+
+		json.NewEncoder(w).Encode(map[string]string{
+			"Code":            "Success",
+			"Type":            "AWS-HMAC",
+			"AccessKeyId":     testImdsAccessKeyID,
+			"SecretAccessKey": testImdsSecretAccessKey,
+			"Token":           testImdsSessionToken,
+			"LastUpdated":     time.Now().UTC().Format(time.RFC3339),
+			"Expiration":      time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+		})
+	})
+
+	stub.Server = httptest.NewServer(mux)
+	t.Cleanup(stub.Close)
+
+	return stub
+}
+
+func (s *imdsStub) RequestCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func (s *imdsStub) TokenTTLs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.tokenTTLs...)
+}
+
+func newTestAWSMethod(t *testing.T, config map[string]interface{}) *awsMethod {
+	t.Helper()
+
+	a, err := NewAWSAuthMethod(&auth.AuthConfig{
+		Logger:    logging.NewVaultLogger(hclog.Trace),
+		MountPath: "auth/aws",
+		Config:    config,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return a.(*awsMethod)
+}
+
+func TestAWSAuth_ImdsEndpoint(t *testing.T) {
+	stub := newImdsStub(t)
+
+	a := newTestAWSMethod(t, map[string]interface{}{
+		"role":          "dev",
+		"imds_endpoint": stub.URL,
+	})
+
+	creds, err := retrieveImdsCredentials(context.Background(), aws.Config{Region: "eu-west-2"}, a.imdsOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if creds.AccessKeyID != testImdsAccessKeyID {
+		t.Fatalf("expected access key id %q, got %q", testImdsAccessKeyID, creds.AccessKeyID)
+	}
+	if creds.SessionToken != testImdsSessionToken {
+		t.Fatalf("expected session token %q, got %q", testImdsSessionToken, creds.SessionToken)
+	}
+	if stub.RequestCount() == 0 {
+		t.Fatal("expected the configured IMDS endpoint to be used")
+	}
+}
+
+func TestAWSAuth_ImdsTokenTTL(t *testing.T) {
+	testCases := map[string]struct {
+		ttl      interface{}
+		expected string
+	}{
+		"seconds": {
+			ttl:      60,
+			expected: "60",
+		},
+		"duration_string": {
+			ttl:      "2m",
+			expected: "120",
+		},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			stub := newImdsStub(t)
+
+			a := newTestAWSMethod(t, map[string]interface{}{
+				"role":           "dev",
+				"imds_endpoint":  stub.URL,
+				"imds_token_ttl": tc.ttl,
+			})
+
+			if _, err := retrieveImdsCredentials(context.Background(), aws.Config{Region: "eu-west-2"}, a.imdsOptions); err != nil {
+				t.Fatal(err)
+			}
+
+			ttls := stub.TokenTTLs()
+			if len(ttls) == 0 {
+				t.Fatal("expected an IMDSv2 token request")
+			}
+			for _, got := range ttls {
+				if got != tc.expected {
+					t.Fatalf("expected token TTL %q, got %q", tc.expected, got)
+				}
+			}
+		})
+	}
+}
+
+func TestAWSAuth_ImdsTokenTTLOutOfRange(t *testing.T) {
+	_, err := NewAWSAuthMethod(&auth.AuthConfig{
+		Logger:    logging.NewVaultLogger(hclog.Trace),
+		MountPath: "auth/aws",
+		Config: map[string]interface{}{
+			"imds_token_ttl": "7h",
+		},
+	})
+	if err == nil {
+		t.Fatal("expected error for out of range 'imds_token_ttl'")
+	}
+}
+
+var testCredentials = aws.Credentials{
+	AccessKeyID:     testImdsAccessKeyID,
+	SecretAccessKey: testImdsSecretAccessKey,
+	Source:          "test",
+}
+
+// stsRequestHeaders decodes the signed STS request headers from a login
+// payload.
+func stsRequestHeaders(t *testing.T, payload map[string]interface{}) map[string]interface{} {
+	t.Helper()
+
+	encoded, ok := payload["iam_request_headers"].(string)
+	if !ok {
+		t.Fatalf("expected 'iam_request_headers' to be a string, got %T", payload["iam_request_headers"])
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var headers map[string]interface{}
+	if err := json.Unmarshal(raw, &headers); err != nil {
+		t.Fatal(err)
+	}
+
+	return headers
+}
+
+func TestAWSAuth_SigningTime(t *testing.T) {
+	signingTime := time.Date(2024, time.January, 2, 3, 4, 5, 0, time.UTC)
+
+	a := newTestAWSMethod(t, map[string]interface{}{
+		"role": "dev",
+	})
+	a.now = func() time.Time {
+		return signingTime
+	}
+
+	_, _, payload, err := a.loginRequest(context.Background(), testCredentials, "eu-west-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	headers := stsRequestHeaders(t, payload)
+
+	if got := headers["X-Amz-Date"]; got != "20240102T030405Z" {
+		t.Fatalf("expected X-Amz-Date %q, got %q", "20240102T030405Z", got)
+	}
+
+	authorization, _ := headers["Authorization"].(string)
+	if !strings.Contains(authorization, "Credential="+testImdsAccessKeyID+"/20240102/eu-west-2/sts/aws4_request") {
+		t.Fatalf("expected credential scope to use the injected time, got %q", authorization)
+	}
+}
+
+func TestAWSAuth_SigningOverrides(t *testing.T) {
+	testCases := map[string]struct {
+		config        map[string]interface{}
+		expectedScope string
+	}{
+		"defaults": {
+			config:        map[string]interface{}{},
+			expectedScope: "/20240102/eu-west-2/sts/aws4_request",
+		},
+		"region": {
+			config: map[string]interface{}{
+				"signing_region": "private-1",
+			},
+			expectedScope: "/20240102/private-1/sts/aws4_request",
+		},
+		"service": {
+			config: map[string]interface{}{
+				"signing_service": "custom-sts",
+			},
+			expectedScope: "/20240102/eu-west-2/custom-sts/aws4_request",
+		},
+		"both": {
+			config: map[string]interface{}{
+				"signing_region":  "private-1",
+				"signing_service": "custom-sts",
+			},
+			expectedScope: "/20240102/private-1/custom-sts/aws4_request",
+		},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			tc.config["role"] = "dev"
+
+			a := newTestAWSMethod(t, tc.config)
+			a.now = func() time.Time {
+				return time.Date(2024, time.January, 2, 3, 4, 5, 0, time.UTC)
+			}
+
+			_, _, payload, err := a.loginRequest(context.Background(), testCredentials, "eu-west-2")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			authorization, _ := stsRequestHeaders(t, payload)["Authorization"].(string)
+			if !strings.Contains(authorization, "Credential="+testImdsAccessKeyID+tc.expectedScope) {
+				t.Fatalf("expected credential scope %q, got %q", tc.expectedScope, authorization)
+			}
+		})
+	}
+}
+
+func TestAWSAuth_SessionTokenSigned(t *testing.T) {
+	creds := testCredentials
+	creds.SessionToken = testImdsSessionToken
+
+	a := newTestAWSMethod(t, map[string]interface{}{
+		"role": "dev",
+	})
+
+	_, _, payload, err := a.loginRequest(context.Background(), creds, "eu-west-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	headers := stsRequestHeaders(t, payload)
+
+	if got := headers["X-Amz-Security-Token"]; got != testImdsSessionToken {
+		t.Fatalf("expected X-Amz-Security-Token %q, got %q", testImdsSessionToken, got)
+	}
+
+	authorization, _ := headers["Authorization"].(string)
+	_, signedHeaders, ok := strings.Cut(authorization, "SignedHeaders=")
+	if !ok {
+		t.Fatalf("expected SignedHeaders in Authorization, got %q", authorization)
+	}
+	signedHeaders, _, _ = strings.Cut(signedHeaders, ",")
+	if !slices.Contains(strings.Split(signedHeaders, ";"), "x-amz-security-token") {
+		t.Fatalf("expected x-amz-security-token to be signed, got SignedHeaders=%s", signedHeaders)
+	}
+}
+
+func TestAWSAuth_WrapTTL(t *testing.T) {
+	// Wrapping belongs on the auto_auth method block, where the auth handler
+	// knows to unwrap the response.
+	_, err := NewAWSAuthMethod(&auth.AuthConfig{
+		Logger:    logging.NewVaultLogger(hclog.Trace),
+		MountPath: "auth/aws",
+		Config: map[string]interface{}{
+			"role":     "dev",
+			"wrap_ttl": "5m",
+		},
+	})
+	if err == nil || !strings.Contains(err.Error(), "auto_auth method block") {
+		t.Fatalf("expected wrap_ttl in the method config to be rejected, got %v", err)
+	}
+
+	a := newTestAWSMethod(t, map[string]interface{}{"role": "dev"})
+	_, header, _, err := a.loginRequest(context.Background(), testCredentials, "eu-west-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(header.Values(api.WrapTTLHeaderName)) != 0 {
+		t.Fatalf("expected the login request not to ask for wrapping")
+	}
+}
+
+func TestAWSAuth_Namespace(t *testing.T) {
+	testCases := map[string]struct {
+		namespace string
+	}{
+		"unset": {},
+		"set": {
+			namespace: "team-a/",
+		},
+	}
+
+	for k, tc := range testCases {
+		t.Run(k, func(t *testing.T) {
+			config := map[string]interface{}{
+				"role": "dev",
+			}
+			if tc.namespace != "" {
+				config["namespace"] = tc.namespace
+			}
+
+			a := newTestAWSMethod(t, config)
+
+			_, header, _, err := a.loginRequest(context.Background(), testCredentials, "eu-west-2")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			values := header.Values(api.NamespaceHeaderName)
+			if tc.namespace == "" {
+				if len(values) != 0 {
+					t.Fatalf("expected no %s header, got %v", api.NamespaceHeaderName, values)
+				}
+				return
+			}
+			if len(values) != 1 || values[0] != tc.namespace {
+				t.Fatalf("expected %s header %q, got %v", api.NamespaceHeaderName, tc.namespace, values)
+			}
+		})
+	}
+}
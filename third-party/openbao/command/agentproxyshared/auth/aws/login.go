@@ -0,0 +1,186 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/hashicorp/go-hclog"
+	"github.com/openbao/openbao/api/v2"
+)
+
+const defaultMountPath = "auth/aws"
+
+// Config configures a standalone AWS IAM login against OpenBao, for tools
+// that need a token without running the agent.
+type Config struct {
+	// Address is the OpenBao address. When empty, the api package defaults
+	// (including BAO_ADDR) apply.
+	Address string
+
+	// Addresses lists OpenBao addresses to try in order, failing over to the
+	// next when a login fails. When set, Address is ignored.
+	Addresses []string
+
+	// MountPath is the mount path of the AWS auth method, "auth/aws" by
+	// default.
+	MountPath string
+
+	Role              string
+	ServerID          string
+	Region            string
+	UseGlobalEndpoint bool
+
+	// Namespace is the OpenBao namespace to log in to, if any.
+	Namespace string
+
+	// SigningRegion and SigningService override the SigV4 scope of the STS
+	// request. By default the request region and "sts" are used.
+	SigningRegion  string
+	SigningService string
+
+	// CACert is the path to a PEM-encoded CA certificate used to verify the
+	// OpenBao server, for servers with certificates from a private CA.
+	CACert string
+
+	// TLSSkipVerify disables verification of the OpenBao server certificate.
+	// It is only meant for development.
+	TLSSkipVerify bool
+
+	// Timeout bounds each request to OpenBao, and so each address tried.
+	// When zero, the api package default applies.
+	Timeout time.Duration
+
+	// Credentials provides the AWS credentials used to sign the STS request.
+	// When nil, credentials are retrieved from IMDS.
+	Credentials aws.CredentialsProvider
+
+	Logger hclog.Logger
+}
+
+// Login authenticates to OpenBao with the AWS IAM auth method and returns the
+// client token and its lease duration.
+func Login(ctx context.Context, cfg Config) (string, time.Duration, error) {
+	m := &awsMethod{
+		logger:            cfg.Logger,
+		mountPath:         cfg.MountPath,
+		region:            cfg.Region,
+		useGlobalEndpoint: cfg.UseGlobalEndpoint,
+		serverId:          cfg.ServerID,
+		role:              cfg.Role,
+		namespace:         cfg.Namespace,
+		signingRegion:     cfg.SigningRegion,
+		signingService:    cfg.SigningService,
+		now:               time.Now,
+	}
+	if m.mountPath == "" {
+		m.mountPath = defaultMountPath
+	}
+	if m.logger == nil {
+		m.logger = hclog.NewNullLogger()
+	}
+
+	region := cfg.Region
+	var creds aws.Credentials
+	if cfg.Credentials == nil || region == "" {
+		awsCfg, err := loadConfig(ctx, cfg.Region)
+		if err != nil {
+			return "", 0, fmt.Errorf("failed to load AWS config: %w", err)
+		}
+		region = awsCfg.Region
+
+		if cfg.Credentials == nil {
+			creds, err = retrieveImdsCredentials(ctx, awsCfg, m.imdsOptions)
+			if err != nil {
+				return "", 0, fmt.Errorf("failed to retrieve credentials from IMDS: %w", err)
+			}
+		}
+	}
+
+	if cfg.Credentials != nil {
+		var err error
+		creds, err = cfg.Credentials.Retrieve(ctx)
+		if err != nil {
+			return "", 0, fmt.Errorf("failed to retrieve AWS credentials: %w", err)
+		}
+	}
+
+	m.logger.Debug("retrieved AWS credentials", "source", creds.Source, "temporary", creds.SessionToken != "")
+
+	path, header, payload, err := m.loginRequest(ctx, creds, region)
+	if err != nil {
+		return "", 0, err
+	}
+
+	addresses := cfg.Addresses
+	if len(addresses) == 0 {
+		addresses = []string{cfg.Address}
+	}
+
+	var errs []error
+	for i, address := range addresses {
+		secret, err := loginAt(ctx, cfg, address, path, header, payload)
+		if err != nil {
+			errs = append(errs, err)
+			if ctx.Err() != nil {
+				break
+			}
+			if i < len(addresses)-1 {
+				m.logger.Warn("OpenBao login failed, trying next address", "address", address, "error", err)
+			}
+			continue
+		}
+
+		lease := time.Duration(secret.Auth.LeaseDuration) * time.Second
+
+		// The client token is the login's result and is never logged.
+		m.logger.Debug("logged in to OpenBao", "address", address, "mount_path", m.mountPath, "accessor", secret.Auth.Accessor, "lease_duration", lease)
+
+		return secret.Auth.ClientToken, lease, nil
+	}
+
+	return "", 0, errors.Join(errs...)
+}
+
+// loginAt sends the login request to a single OpenBao address. An empty
+// address leaves the api package defaults in place.
+func loginAt(ctx context.Context, cfg Config, address, path string, header http.Header, payload map[string]interface{}) (*api.Secret, error) {
+	clientCfg := api.DefaultConfig()
+	if clientCfg.Error != nil {
+		return nil, fmt.Errorf("failed to load OpenBao client config: %w", clientCfg.Error)
+	}
+	if address != "" {
+		clientCfg.Address = address
+	}
+	if cfg.Timeout > 0 {
+		clientCfg.Timeout = cfg.Timeout
+	}
+	if cfg.CACert != "" || cfg.TLSSkipVerify {
+		if err := clientCfg.ConfigureTLS(&api.TLSConfig{
+			CACert:   cfg.CACert,
+			Insecure: cfg.TLSSkipVerify,
+		}); err != nil {
+			return nil, fmt.Errorf("failed to configure TLS for OpenBao client: %w", err)
+		}
+	}
+
+	client, err := api.NewClient(clientCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OpenBao client: %w", err)
+	}
+	client.ClearToken()
+	client.SetHeaders(header)
+
+	secret, err := client.Logical().WriteWithContext(ctx, path, payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to log in to OpenBao at %s: %w", client.Address(), err)
+	}
+	if secret == nil || secret.Auth == nil {
+		return nil, fmt.Errorf("login response from %s did not contain auth information", client.Address())
+	}
+
+	return secret, nil
+}
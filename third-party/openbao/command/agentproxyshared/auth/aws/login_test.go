@@ -0,0 +1,264 @@
+package aws
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	hclog "github.com/hashicorp/go-hclog"
+)
+
+// newOpenBaoStub serves a single AWS auth login endpoint, returning token for
+// every successful login and recording the request body.
+func newOpenBaoStub(t *testing.T, mountPath, token string, body *map[string]interface{}) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(openBaoLoginHandler(mountPath, token, body))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func openBaoLoginHandler(mountPath, token string, body *map[string]interface{}) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/"+mountPath+"/login", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut && r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"auth": map[string]interface{}{
+				"client_token":   token,
+				"lease_duration": 3600,
+				"renewable":      true,
+			},
+		})
+	})
+
+	return mux
+}
+
+func TestLogin(t *testing.T) {
+	var body map[string]interface{}
+	server := newOpenBaoStub(t, "auth/aws", "s.test-token", &body)
+
+	token, lease, err := Login(context.Background(), Config{
+		Address:     server.URL,
+		Role:        "dev",
+		ServerID:    "openbao.example.com",
+		Region:      "eu-west-2",
+		Credentials: credentials.NewStaticCredentialsProvider(testImdsAccessKeyID, testImdsSecretAccessKey, ""),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token != "s.test-token" {
+		t.Fatalf("expected token %q, got %q", "s.test-token", token)
+	}
+	if lease != time.Hour {
+		t.Fatalf("expected lease %s, got %s", time.Hour, lease)
+	}
+
+	if body["role"] != "dev" {
+		t.Fatalf("expected role %q, got %v", "dev", body["role"])
+	}
+
+	headers := stsRequestHeaders(t, body)
+	if headers["X-Vault-Aws-Iam-Server-Id"] != "openbao.example.com" {
+		t.Fatalf("expected server id header %q, got %v", "openbao.example.com", headers["X-Vault-Aws-Iam-Server-Id"])
+	}
+}
+
+func TestLogin_CustomMountPath(t *testing.T) {
+	var body map[string]interface{}
+	server := newOpenBaoStub(t, "auth/aws-prod", "s.prod-token", &body)
+
+	token, _, err := Login(context.Background(), Config{
+		Address:     server.URL,
+		MountPath:   "auth/aws-prod",
+		Role:        "prod",
+		Region:      "eu-west-2",
+		Credentials: credentials.NewStaticCredentialsProvider(testImdsAccessKeyID, testImdsSecretAccessKey, ""),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token != "s.prod-token" {
+		t.Fatalf("expected token %q, got %q", "s.prod-token", token)
+	}
+}
+
+func TestLogin_NoAuthInResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data":{}}`))
+	}))
+	t.Cleanup(server.Close)
+
+	_, _, err := Login(context.Background(), Config{
+		Address:     server.URL,
+		Role:        "dev",
+		Region:      "eu-west-2",
+		Credentials: credentials.NewStaticCredentialsProvider(testImdsAccessKeyID, testImdsSecretAccessKey, ""),
+	})
+	if err == nil {
+		t.Fatal("expected an error when the response has no auth")
+	}
+}
+
+func TestLogin_CACert(t *testing.T) {
+	var body map[string]interface{}
+	server := httptest.NewTLSServer(openBaoLoginHandler("auth/aws", "s.tls-token", &body))
+	t.Cleanup(server.Close)
+
+	caCert := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caCert, certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Config{
+		Address:     server.URL,
+		Role:        "dev",
+		Region:      "eu-west-2",
+		Timeout:     5 * time.Second,
+		Credentials: credentials.NewStaticCredentialsProvider(testImdsAccessKeyID, testImdsSecretAccessKey, ""),
+	}
+
+	if _, _, err := Login(context.Background(), cfg); err == nil {
+		t.Fatal("expected login to fail without the server's CA")
+	}
+
+	cfg.CACert = caCert
+	token, _, err := Login(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "s.tls-token" {
+		t.Fatalf("expected token %q, got %q", "s.tls-token", token)
+	}
+}
+
+func TestLogin_RedactsSecretsInLogs(t *testing.T) {
+	const (
+		sessionToken = "FQoGZXIvYXdzEXAMPLESESSIONTOKEN"
+		clientToken  = "s.redaction-token"
+	)
+
+	var body map[string]interface{}
+	server := newOpenBaoStub(t, "auth/aws", clientToken, &body)
+
+	var logs bytes.Buffer
+	_, _, err := Login(context.Background(), Config{
+		Address:     server.URL,
+		Role:        "dev",
+		Region:      "eu-west-2",
+		Credentials: credentials.NewStaticCredentialsProvider(testImdsAccessKeyID, testImdsSecretAccessKey, sessionToken),
+		Logger: hclog.New(&hclog.LoggerOptions{
+			Output: &logs,
+			Level:  hclog.Trace,
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authorization, _ := stsRequestHeaders(t, body)["Authorization"].(string)
+	_, signature, ok := strings.Cut(authorization, "Signature=")
+	if !ok || signature == "" {
+		t.Fatalf("expected a signature in Authorization, got %q", authorization)
+	}
+
+	if !strings.Contains(logs.String(), redacted) {
+		t.Fatalf("expected redacted STS headers in debug logs, got:\n%s", logs.String())
+	}
+
+	for name, secret := range map[string]string{
+		"secret access key": testImdsSecretAccessKey,
+		"session token":     sessionToken,
+		"signature":         signature,
+		"client token":      clientToken,
+	} {
+		if strings.Contains(logs.String(), secret) {
+			t.Fatalf("debug logs contain the %s:\n%s", name, logs.String())
+		}
+	}
+}
+
+func TestLogin_Failover(t *testing.T) {
+	var failed int
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		failed++
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"errors":["permission denied"]}`))
+	}))
+	t.Cleanup(down.Close)
+
+	var body map[string]interface{}
+	up := newOpenBaoStub(t, "auth/aws", "s.second-token", &body)
+
+	token, _, err := Login(context.Background(), Config{
+		Address:     "http://unused.example.com",
+		Addresses:   []string{down.URL, up.URL},
+		Role:        "dev",
+		Region:      "eu-west-2",
+		Timeout:     5 * time.Second,
+		Credentials: credentials.NewStaticCredentialsProvider(testImdsAccessKeyID, testImdsSecretAccessKey, ""),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if failed != 1 {
+		t.Fatalf("expected the first address to be tried once, got %d", failed)
+	}
+	if token != "s.second-token" {
+		t.Fatalf("expected token %q from the second address, got %q", "s.second-token", token)
+	}
+	if body["role"] != "dev" {
+		t.Fatalf("expected the second address to receive the login, got %v", body)
+	}
+}
+
+func TestLogin_FailoverExhausted(t *testing.T) {
+	var addresses []string
+	for range 2 {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+		}))
+		t.Cleanup(server.Close)
+		addresses = append(addresses, server.URL)
+	}
+
+	_, _, err := Login(context.Background(), Config{
+		Addresses:   addresses,
+		Role:        "dev",
+		Region:      "eu-west-2",
+		Credentials: credentials.NewStaticCredentialsProvider(testImdsAccessKeyID, testImdsSecretAccessKey, ""),
+	})
+	if err == nil {
+		t.Fatal("expected an error when every address fails")
+	}
+	for _, address := range addresses {
+		if !strings.Contains(err.Error(), address) {
+			t.Fatalf("expected the error to name %s, got %v", address, err)
+		}
+	}
+}